@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sakolb/bcd/internal/config"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/tui"
+)
+
+// commandLineOnly are the flags that make no sense as a standing setting,
+// so config files can't set them.
+var commandLineOnly = map[string]bool{
+	"filter": true,
+	"query":  true,
+	"q":      true,
+	"output": true,
+}
+
+// loadConfig applies the config files of opts.baseDir, then the flags in
+// BCD_DEFAULT_OPTS, to opts through fs, whose flags opts.flags tracks.
+func loadConfig(opts *options, fs *flag.FlagSet) error {
+	opts.flags.Keyed("weight", "=")
+	opts.flags.Keyed("theme", "=")
+	opts.flags.Keyed("bind", ":")
+	opts.flags.Keyed("marker", ":")
+	opts.flags.Keyed("ignore", "")
+	// Lists add up from one source to the next, except the types shown
+	opts.flags.Replace("type", func() { opts.types = nil })
+
+	settings, err := configFiles(opts.baseDir)
+	if err != nil {
+		return err
+	}
+	for _, s := range settings {
+		if commandLineOnly[s.Flag] {
+			return fmt.Errorf("%s: %s can only be given on the command line", s.Source, s.Flag)
+		}
+	}
+	if err := opts.flags.Apply(settings); err != nil {
+		return err
+	}
+
+	args, err := config.Env()
+	if err != nil {
+		return err
+	}
+	opts.flags.From(config.SourceEnv)
+	positional, err := parseSubcommand(fs, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", config.EnvVar, err)
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("%s: unexpected argument %q", config.EnvVar, positional[0])
+	}
+	return nil
+}
+
+// configFiles returns the settings of the user's config file, then those
+// of dir's, which may not run commands.
+func configFiles(dir string) ([]config.Setting, error) {
+	path, err := config.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := config.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dirSettings, err := config.ReadDirFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	return append(settings, dirSettings...), nil
+}
+
+// runConfig implements `bcd config show [dir] [options]`, printing the
+// settings bcd would run with, in the config file format, each commented
+// with where it came from.
+func runConfig(args []string, w io.Writer) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(os.Stderr, "Usage: bcd config show [dir|@NAME] [options]\n")
+		return exitError
+	}
+	opts, err := parseArgs(args[1:])
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if err := writeConfig(w, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// writeConfig writes the settings of opts as a config file would set them.
+func writeConfig(w io.Writer, opts *options) error {
+	f := opts.flags
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	line := func(setting string, source string) {
+		fmt.Fprintf(tw, "%s\t# %s\n", setting, source)
+	}
+	// list writes an array one value per line, with the source of its key
+	list := func(name string, values []string, keys []string) {
+		if len(values) == 0 {
+			line(name+" = []", f.Source(name))
+			return
+		}
+		fmt.Fprintf(tw, "%s = [\n", name)
+		for i, v := range values {
+			line("  "+strconv.Quote(v)+",", f.KeySource(name, keys[i]))
+		}
+		fmt.Fprintf(tw, "]\n")
+	}
+
+	path, err := config.DefaultPath()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(tw, "# Settings for %s, from the defaults, %s,\n# %s, %s and the command line\n\n",
+		opts.baseDir, path, config.DirPath(opts.baseDir), config.EnvVar)
+
+	line(fmt.Sprintf("sort = %q", opts.sort), f.Source("sort"))
+	types := make([]string, len(opts.types))
+	for i, t := range opts.types {
+		types[i] = strconv.Quote(t.String())
+	}
+	line("type = ["+strings.Join(types, ", ")+"]", f.Source("type"))
+	for _, b := range []struct {
+		name  string
+		value bool
+	}{
+		{"long", opts.long},
+		{"repos", opts.repos},
+		{"projects", opts.projects},
+		{"explain", opts.explain},
+		{"select-1", opts.select1},
+		{"exit-0", opts.exit0},
+		{"print0", opts.print0},
+		{"no-daemon", opts.noDaemon},
+		{"no-watch", opts.noWatch},
+		{"archives", opts.archives},
+	} {
+		line(fmt.Sprintf("%s = %t", b.name, b.value), f.Source(b.name))
+	}
+	list("ignore", opts.ignore, opts.ignore)
+	markers := make([]string, len(opts.markers))
+	files := make([]string, len(opts.markers))
+	for i, m := range opts.markers {
+		markers[i] = markerString(m)
+		files[i] = m.File
+	}
+	list("marker", markers, files)
+
+	fmt.Fprintf(tw, "\n[weights]\n")
+	line(fmt.Sprintf("project = %d", opts.weights.Project), f.KeySource("weight", "project"))
+	line(fmt.Sprintf("recency = %d", opts.weights.Recency), f.KeySource("weight", "recency"))
+	line(fmt.Sprintf("half-life = %q", formatDuration(opts.weights.HalfLife)), f.KeySource("weight", "half-life"))
+
+	fmt.Fprintf(tw, "\n[theme]\n")
+	for _, name := range tui.ThemeColors {
+		line(fmt.Sprintf("%s = %q", name, opts.theme.Get(name)), f.KeySource("theme", name))
+	}
+
+	fmt.Fprintf(tw, "\n[keymap]\n")
+	for _, key := range opts.bindings.Keys() {
+		line(fmt.Sprintf("%q = %q", key, opts.bindings[key].String()), f.KeySource("bind", key))
+	}
+	return tw.Flush()
+}
+
+// markerString returns m as --marker takes it.
+func markerString(m project.Marker) string {
+	if m.Kind == m.File {
+		return m.File
+	}
+	return m.File + ":" + m.Kind
+}
+
+// formatDuration formats d without the zero minutes and seconds that
+// time.Duration.String adds to whole hours.
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "h0m0s") {
+		return strings.TrimSuffix(s, "0m0s")
+	}
+	if strings.HasSuffix(s, "m0s") {
+		return strings.TrimSuffix(s, "0s")
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sakolb/bcd/internal/daemon"
+)
+
+// runDaemon implements `bcd daemon [ROOT...]`, indexing the roots (the
+// home directory by default) and serving crawls of them until interrupted.
+// With --status, it prints the running daemon's index size instead.
+func runDaemon(args []string, w io.Writer) int {
+	flags := flag.NewFlagSet("bcd daemon", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: bcd daemon [ROOT...] [options]\n       bcd daemon --status\n\nOptions:\n")
+		flags.PrintDefaults()
+	}
+	socket := flags.String("socket", daemon.DefaultSocket(), "listen on `PATH`")
+	status := flags.Bool("status", false, "print the running daemon's roots and index size, and exit")
+	var ignore []string
+	flags.Func("ignore", "don't index entries whose name matches `PATTERN`; repeated as needed", func(s string) error {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return fmt.Errorf("%q: %w", s, err)
+		}
+		ignore = append(ignore, s)
+		return nil
+	})
+	roots, err := parseSubcommand(flags, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	if *status {
+		return printDaemonStatus(w, *socket)
+	}
+	if len(roots) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		roots = []string{home}
+	}
+
+	ln, err := daemon.Listen(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	defer os.Remove(*socket)
+
+	// Directories that can't be read are only counted: there are usually
+	// many of them, and nothing to do about them
+	var denied atomic.Int64
+	index := daemon.NewIndex(ignore, func(err error) {
+		if errors.Is(err, fs.ErrPermission) {
+			denied.Add(1)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "bcd daemon: %v\n", err)
+	})
+	defer index.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve while the roots are scanned: crawls of a root are refused
+	// until its scan is done, so clients crawl by themselves meanwhile
+	// instead of waiting for it
+	served := make(chan error, 1)
+	go func() { served <- daemon.NewServer(index).Serve(ctx, ln) }()
+	fmt.Fprintf(os.Stderr, "bcd daemon: listening on %s\n", *socket)
+
+	start := time.Now()
+	for _, root := range roots {
+		if err := index.AddRoot(root); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			stop()
+			<-served
+			return exitError
+		}
+	}
+	s := index.Stats()
+	fmt.Fprintf(os.Stderr, "bcd daemon: indexed %d dirs and %d files under %s in %.1fs (%d unreadable)\n",
+		s.Dirs, s.Files, strings.Join(s.Roots, ", "), time.Since(start).Seconds(), denied.Load())
+
+	go index.Run()
+	if err := <-served; err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func printDaemonStatus(w io.Writer, socket string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s, err := daemon.NewClient(socket).Stats(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	fmt.Fprintf(w, "socket   %s\n", socket)
+	for _, root := range s.Roots {
+		if slices.Contains(s.Scanning, root) {
+			root += " (scanning)"
+		}
+		fmt.Fprintf(w, "root     %s\n", root)
+	}
+	fmt.Fprintf(w, "dirs     %d\nfiles    %d\nwatches  %d\n", s.Dirs, s.Files, s.Watches)
+	return exitOK
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/daemon"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+// runFilter ranks every candidate against opts.filter and writes the
+// matching paths to w, best match first, without starting the TUI. It
+// returns the number of paths written.
+func runFilter(opts *options, stdin *os.File, w io.Writer) (int, error) {
+	src := primarySource(opts, stdin)
+	entries := collectEntries(streamEntries(src))
+	r := src.NewRanker()
+	results := rankEntries(r, entries, opts.filter, opts)
+
+	bw := bufio.NewWriter(w)
+	for _, res := range results {
+		if err := writeResult(bw, res.Entry.AbsPath(), opts.print0); err != nil {
+			return 0, err
+		}
+	}
+	if opts.explain {
+		// Explanations go to stderr, leaving stdout to the results
+		ew := bufio.NewWriter(os.Stderr)
+		for i, res := range results {
+			if i > 0 {
+				ew.WriteString("\n")
+			}
+			r.Explain(opts.filter, res.Entry).WriteText(ew)
+		}
+		ew.Flush()
+	}
+	return len(results), bw.Flush()
+}
+
+// rankEntries returns the entries of the wanted types matching query with
+// r, in the wanted order.
+func rankEntries(r *ranker.Ranker, entries []*entry.PathEntry, query string, opts *options) []ranker.ScoredEntry {
+	r.SetWeights(opts.weights)
+	r.SetTypes(opts.types)
+	r.SetSort(opts.sort)
+	r.AddEntryBatch(entries)
+	r.SetQuery(query)
+	return r.Results()
+}
+
+// collectEntries drains entries into a slice.
+func collectEntries(entries <-chan *entry.PathEntry) []*entry.PathEntry {
+	collected := make([]*entry.PathEntry, 0, 100)
+	for e := range entries {
+		collected = append(collected, e)
+	}
+	return collected
+}
+
+// awaitMatches reads entries until the --select-1 and --exit-0 decision
+// can be made: until they run out, or until there are as many matches for
+// the query as make the picker necessary, two with --select-1 and one
+// otherwise. It returns the entries read, the matches, and whether the
+// entries ran out.
+func awaitMatches(r *ranker.Ranker, entries <-chan *entry.PathEntry, opts *options) ([]*entry.PathEntry, []ranker.ScoredEntry, bool) {
+	r.SetWeights(opts.weights)
+	r.SetTypes(opts.types)
+	r.SetSort(opts.sort)
+	r.SetQuery(opts.query)
+	enough := 1
+	if opts.select1 {
+		enough = 2
+	}
+	read := make([]*entry.PathEntry, 0, 100)
+	for e := range entries {
+		read = append(read, e)
+		r.AddEntry(e)
+		if r.Matches() >= enough {
+			return read, r.Results(), false
+		}
+	}
+	return read, r.Results(), true
+}
+
+// primarySource returns the source of candidates: stdin, one path per
+// line, when it is piped, and a crawl of the base directory otherwise.
+func primarySource(opts *options, stdin *os.File) source.Source {
+	if isTerminal(stdin) {
+		return crawlSource(opts, opts.baseDir)
+	}
+	src := source.NewReader(source.NameStdin, opts.baseDir, stdin)
+	if opts.projects {
+		// Unlike the crawl, stdin does not recognize projects by itself
+		return source.NewFiltered(filterSource(opts, src), source.DetectProject(opts.markers))
+	}
+	return filterSource(opts, src)
+}
+
+// crawlSource returns a crawl of baseDir honouring opts' filters.
+func crawlSource(opts *options, baseDir string) source.Source {
+	crawlOpts := crawler.DefaultOptions()
+	crawlOpts.Markers = opts.markers
+	crawlOpts.Ignore = opts.ignore
+	crawlOpts.Archives = opts.archives
+	// The picker's rankers filter types, so that toggling one shows its
+	// entries even when it was hidden at first; --filter has no toggles,
+	// and doesn't collect the types it would drop
+	if opts.filterMode {
+		crawlOpts.Types = opts.types
+		if (opts.repos || opts.projects) && len(crawlOpts.Types) == 0 {
+			// Repositories and projects are directories, so don't collect
+			// anything else
+			crawlOpts.Types = []entry.FileType{entry.FileTypeDir}
+		}
+	}
+	crawl := source.NewCrawl(baseDir, crawlOpts)
+	if !opts.noDaemon {
+		crawl.UseDaemon(daemon.NewClient(daemon.DefaultSocket()))
+	}
+	if !opts.filterMode && !opts.noWatch {
+		crawl.WatchChanges()
+	}
+	src := filterSource(opts, crawl)
+	if opts.projects {
+		return source.NewFiltered(src, source.IsProject)
+	}
+	return src
+}
+
+// filterSource restricts src to repository roots for --repos, and loads
+// the metadata of its entries when it is shown or sorted on.
+func filterSource(opts *options, src source.Source) source.Source {
+	if opts.repos {
+		src = source.NewFiltered(src, source.IsRepo)
+	}
+	if opts.metadata() {
+		src = source.NewFiltered(src, source.LoadMetadata)
+	}
+	return src
+}
+
+// streamEntries runs src in the background and returns its entries.
+func streamEntries(src source.Source) <-chan *entry.PathEntry {
+	out := make(chan *entry.PathEntry, 1000)
+	go src.Entries(context.Background(), out)
+	return out
+}
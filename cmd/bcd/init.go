@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sakolb/bcd/internal/history"
+	"github.com/sakolb/bcd/internal/shell"
+)
+
+// runInit implements `bcd init <shell>`, printing the shell integration.
+func runInit(args []string, w io.Writer) int {
+	opts := shell.DefaultOptions()
+	fs := flag.NewFlagSet("bcd init", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd init bash|zsh|fish [options]\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.Cmd, "cmd", opts.Cmd, "name of the shell `function` to define")
+	fs.BoolVar(&opts.Hook, "hook", opts.Hook, "record visited directories in the frecency history on every cd")
+	fs.BoolFunc("no-keybind", "define the path picker widget without binding it to Ctrl-G", func(string) error {
+		opts.Keybind = false
+		return nil
+	})
+
+	shellName, err := parseSubcommand(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if len(shellName) != 1 {
+		fs.Usage()
+		return exitError
+	}
+
+	if err := shell.Render(w, shellName[0], opts); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runAdd implements `bcd add DIR...`, used by the cd hook to record visits
+// in the frecency history.
+func runAdd(args []string) int {
+	fs := flag.NewFlagSet("bcd add", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd add DIR...\n")
+	}
+	dirs, err := parseSubcommand(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	file, err := history.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	now := time.Now()
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := history.Add(file, abs, now); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// parseSubcommand parses args with fs, allowing flags and positional
+// arguments to be interleaved, and returns the positional arguments.
+func parseSubcommand(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		// Everything after a literal "--" is positional
+		if len(args) > fs.NArg() && args[len(args)-fs.NArg()-1] == "--" {
+			return append(positional, fs.Args()...), nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -1,74 +1,399 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
+	"github.com/sakolb/bcd/internal/action"
+	"github.com/sakolb/bcd/internal/bookmark"
+	"github.com/sakolb/bcd/internal/config"
 	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/history"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
 	"github.com/sakolb/bcd/internal/tui"
 )
 
+type options struct {
+	baseDir    string
+	filter     string
+	filterMode bool
+	output     string
+	print0     bool
+	query      string
+	select1    bool
+	exit0      bool
+	// types restricts results to these file types; empty means all.
+	types []entry.FileType
+	// repos lists only git repository roots.
+	repos bool
+	// projects lists only project roots, recognized by markers.
+	projects bool
+	markers  []project.Marker
+	// long shows metadata columns; sort orders the results.
+	long bool
+	sort ranker.SortMode
+	// weights tune the ranking signals: the defaults plus --weight.
+	weights ranker.Weights
+	// explain shows how results were scored.
+	explain bool
+	// bindings are the picker's actions: the defaults plus --bind.
+	bindings action.Bindings
+	// ignore skips the entries matching these patterns while crawling.
+	ignore []string
+	theme  tui.Theme
+	// bookmark is set when the start directory was given as @NAME.
+	bookmark string
+	// noDaemon crawls even when the daemon could answer.
+	noDaemon bool
+	// noWatch leaves the picker's crawl as it was when it finished.
+	noWatch bool
+	// archives crawls inside zip, jar and tar archives.
+	archives bool
+	// flags records where each setting came from.
+	flags *config.Flags
+}
+
+func parseArgs(args []string) (*options, error) {
+	// Parse the command line once on its own for the start directory, which
+	// holds a config file of its own, and to report its mistakes first
+	fs := newFlagSet(defaultOptions())
+	positional, err := parseSubcommand(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) > 1 {
+		return nil, fmt.Errorf("too many arguments: %v", positional)
+	}
+	bookmarkName, baseDir, err := startDir(positional)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := defaultOptions()
+	opts.baseDir = baseDir
+	opts.bookmark = bookmarkName
+	fs = newFlagSet(opts)
+	fs.SetOutput(io.Discard)
+	opts.flags = config.Track(fs)
+	if err := loadConfig(opts, fs); err != nil {
+		return nil, err
+	}
+	opts.flags.From(config.SourceFlags)
+	if _, err := parseSubcommand(fs, args); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func defaultOptions() *options {
+	return &options{
+		bindings: action.DefaultBindings(),
+		markers:  slices.Clone(project.DefaultMarkers),
+		sort:     ranker.SortScore,
+		weights:  ranker.DefaultWeights(),
+		theme:    tui.DefaultTheme(),
+	}
+}
+
+// newFlagSet defines the picker's flags, setting opts.
+func newFlagSet(opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet("bcd", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd [dir|@NAME] [-q QUERY] [options]\n       bcd init bash|zsh|fish [--cmd NAME] [--hook] [--no-keybind]\n       bcd add DIR...\n       bcd mark NAME [path]\n       bcd unmark NAME...\n       bcd marks\n       bcd score QUERY PATH... [--json]\n       bcd config show [dir|@NAME] [options]\n       bcd daemon [ROOT...] [--status]\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	fs.Func("filter", "print candidates matching `QUERY` in rank order and exit", func(s string) error {
+		opts.filter = s
+		opts.filterMode = true
+		return nil
+	})
+	fs.StringVar(&opts.query, "query", "", "start the picker with `QUERY` already typed")
+	fs.StringVar(&opts.query, "q", "", "shorthand for --query")
+	fs.BoolVar(&opts.select1, "select-1", false, "select the only match without showing the picker")
+	fs.BoolVar(&opts.exit0, "exit-0", false, "exit without showing the picker when nothing matches")
+	fs.Func("type", "only show entries of `TYPE`: d (directory), f (file) or l (symlink); comma separated or repeated", func(s string) error {
+		types, err := entry.ParseFileTypes(s)
+		if err != nil {
+			return err
+		}
+		opts.types = append(opts.types, types...)
+		return nil
+	})
+	fs.BoolVar(&opts.repos, "repos", false, "only list the roots of git repositories, with their branch")
+	fs.BoolVar(&opts.projects, "projects", false, "only list project roots (go.mod, package.json, Cargo.toml, pyproject.toml, Makefile, ...)")
+	fs.Func("marker", "also recognize projects by `FILE[:KIND]`; repeated as needed", func(s string) error {
+		m, err := project.ParseMarker(s)
+		if err != nil {
+			return err
+		}
+		opts.markers = append(opts.markers, m)
+		return nil
+	})
+	fs.Func("ignore", "skip entries whose name matches `PATTERN` while crawling, e.g. node_modules or '*.o'; repeated as needed", func(s string) error {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return fmt.Errorf("%q: %w", s, err)
+		}
+		opts.ignore = append(opts.ignore, s)
+		return nil
+	})
+	fs.BoolVar(&opts.long, "long", false, "show the mtime, size, permissions and owner of entries")
+	fs.Func("sort", "order results by `MODE`: score, distance, mtime (most recent first) or name", func(s string) error {
+		mode, err := ranker.ParseSortMode(s)
+		if err != nil {
+			return err
+		}
+		opts.sort = mode
+		return nil
+	})
+	fs.Func("weight", "set a ranking weight, `NAME=VALUE`: project (bonus of project roots), recency (bonus of entries modified just now) or half-life (how fast it decays, e.g. 72h)", opts.weights.ParseWeight)
+	fs.Func("theme", "set a picker color, `NAME=COLOR`: cursor, match, bookmark, project, git-clean or git-dirty, as an ANSI number or #rrggbb", opts.theme.ParseColor)
+	fs.BoolVar(&opts.explain, "explain", false, "show how the selected result was scored (with --filter, every result, on stderr)")
+	fs.Func("bind", "bind `KEY:ACTION` in the picker: edit, page or copy (optionally +exit), execute(CMD) or become(CMD), where {} is the path", func(s string) error {
+		key, a, err := action.ParseBinding(s)
+		if err != nil {
+			return err
+		}
+		opts.bindings[key] = a
+		return nil
+	})
+	fs.BoolVar(&opts.noDaemon, "no-daemon", false, "crawl by itself rather than ask the running bcd daemon")
+	fs.BoolVar(&opts.noWatch, "no-watch", false, "don't follow the directories created, removed or renamed once the picker's crawl is done")
+	fs.BoolVar(&opts.archives, "archives", false, "also crawl inside zip, jar and tar archives; selecting an entry in one extracts it to a temporary directory")
+	fs.StringVar(&opts.output, "output", "-", "write the result to `FILE`, or to file descriptor N if numeric")
+	fs.BoolVar(&opts.print0, "print0", false, "terminate results with NUL instead of newline")
+	return fs
+}
+
+// startDir resolves the start directory given on the command line, the
+// working directory by default, and the bookmark it was given as, if any.
+func startDir(positional []string) (string, string, error) {
+	if len(positional) == 0 {
+		dir, err := os.Getwd()
+		return "", dir, err
+	}
+	if name, ok := strings.CutPrefix(positional[0], "@"); ok {
+		file, err := bookmark.DefaultPath()
+		if err != nil {
+			return "", "", err
+		}
+		b, err := bookmark.Get(file, name)
+		if err != nil {
+			return "", "", err
+		}
+		return name, b.Path, nil
+	}
+	dir, err := filepath.Abs(positional[0])
+	return "", dir, err
+}
+
+// isStartDir reports whether args is a lone word that names a directory in
+// the working directory, which `bcd config` then jumps to rather than run
+// the subcommand of that name. `bcd config --` still runs the subcommand.
+func isStartDir(args []string) bool {
+	if len(args) != 1 {
+		return false
+	}
+	info, err := os.Stat(args[0])
+	return err == nil && info.IsDir()
+}
+
+// Exit codes shared by the TUI and --filter modes, so shell integrations
+// can tell a selection from a cancelled picker or a failure. Subcommands,
+// which select nothing, exit with exitOK or exitError.
+const (
+	exitSelected  = 0
+	exitCancelled = 1
+	exitError     = 2
+
+	exitOK = 0
+)
+
 func main() {
-	baseDir, err := os.Getwd()
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) > 0 && !isStartDir(args) {
+		switch args[0] {
+		case "init":
+			return runInit(args[1:], os.Stdout)
+		case "add":
+			return runAdd(args[1:])
+		case "mark":
+			return runMark(args[1:])
+		case "unmark":
+			return runUnmark(args[1:])
+		case "marks":
+			return runMarks(args[1:], os.Stdout)
+		case "score":
+			return runScore(args[1:], os.Stdout)
+		case "config":
+			return runConfig(args[1:], os.Stdout)
+		case "daemon":
+			return runDaemon(args[1:], os.Stdout)
+		}
+	}
+
+	opts, err := parseArgs(args)
 	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return exitError
+	}
+
+	out, err := openOutput(opts.output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	defer out.Close()
+
+	// `bcd @NAME` jumps straight to the bookmark; with a query it searches
+	// from the bookmark instead
+	if opts.bookmark != "" && opts.query == "" && !opts.filterMode {
+		if err := writeResult(out, opts.baseDir, opts.print0); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		return exitSelected
 	}
-	if len(os.Args) > 1 {
-		baseDir, err = filepath.Abs(os.Args[1])
+
+	if opts.filterMode {
+		n, err := runFilter(opts, os.Stdin, out)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			os.Exit(1)
+			return exitError
+		}
+		if n == 0 {
+			return exitCancelled
 		}
+		return exitSelected
 	}
 
-	model := tui.InitModel(baseDir)
+	primary := primarySource(opts, os.Stdin)
 
-	// Check if stdout is redirected (e.g., in shell function)
-	// If so, use /dev/tty for both input and output to receive resize signals
-	var p *tea.Program
-	fileInfo, _ := os.Stdout.Stat()
-	if (fileInfo.Mode() & os.ModeCharDevice) == 0 {
-		// stdout is redirected, use /dev/tty for TUI to receive signals
-		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
-		if err == nil {
-			defer tty.Close()
-			p = tea.NewProgram(model, tea.WithInput(tty), tea.WithOutput(tty), tea.WithAltScreen())
-		} else {
-			// Fallback if /dev/tty unavailable
-			p = tea.NewProgram(model, tea.WithAltScreen())
+	// --select-1 and --exit-0 decide whether to show the picker at all as
+	// soon as they can: once a second match arrives, the picker opens
+	// without waiting for the rest of the crawl
+	if opts.select1 || opts.exit0 {
+		entries := streamEntries(primary)
+		read, results, done := awaitMatches(primary.NewRanker(), entries, opts)
+		switch {
+		case done && len(results) == 1 && opts.select1:
+			if err := writeResult(out, results[0].Entry.AbsPath(), opts.print0); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return exitError
+			}
+			return exitSelected
+		case done && len(results) == 0 && opts.exit0:
+			return exitCancelled
 		}
-	} else {
-		// stdout is a terminal, use normally
-		p = tea.NewProgram(model, tea.WithAltScreen())
+		primary = source.NewResumed(primary, read, entries)
 	}
 
-	c := crawler.NewCrawler()
-	go func() {
-		go c.Crawl(baseDir)
+	selected, err := runPicker(opts, primary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if selected == "" {
+		return exitCancelled
+	}
+	if err := writeResult(out, selected, opts.print0); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitSelected
+}
+
+// metadata reports whether entries need their metadata: to show it, or to
+// sort on mtime.
+func (opts *options) metadata() bool {
+	return opts.long || opts.sort == ranker.SortMTime
+}
 
-		for path := range c.Paths() {
-			e, err := entry.NewPathEntry(path, baseDir)
-			if err != nil {
-				continue
+// runPicker runs the TUI and returns the selected path, or "" if the user
+// cancelled. The primary source is the first tab; crawls also get tabs for
+// the frecency history, bookmarks and known repositories.
+func runPicker(opts *options, primary source.Source) (string, error) {
+	// These are conveniences; without a config or data dir the picker still works
+	bookmarksFile, _ := bookmark.DefaultPath()
+	historyFile, _ := history.DefaultPath()
+
+	// Crawled results can be re-rooted from the picker; candidates read from
+	// stdin cannot be read again
+	var newSources func(baseDir string) []source.Source
+	sources := []source.Source{primary}
+	if primary.Name() == source.NameCrawl {
+		newSources = func(baseDir string) []source.Source {
+			return []source.Source{
+				crawlSource(opts, baseDir),
+				filterSource(opts, source.NewHistory(historyFile, baseDir)),
+				filterSource(opts, source.NewBookmarks(bookmarksFile, baseDir)),
+				filterSource(opts, source.NewRepos(baseDir, historyFile, bookmarksFile)),
 			}
-			p.Send(tui.EntryMsg(e))
 		}
-		p.Send(tui.CrawlDoneMsg{})
-	}()
+		// Keep the primary source, which may already hold collected entries
+		sources = append(sources, newSources(opts.baseDir)[1:]...)
+	}
+
+	model := tui.InitModel(opts.baseDir, tui.Options{
+		Query:         opts.query,
+		BookmarksFile: bookmarksFile,
+		Sources:       sources,
+		NewSources:    newSources,
+		Types:         opts.types,
+		Bindings:      opts.bindings,
+		Long:          opts.metadata(),
+		Sort:          opts.sort,
+		Weights:       &opts.weights,
+		Explain:       opts.explain,
+		Theme:         &opts.theme,
+	})
+
+	// Results go to stdout, so the TUI can only share it when both stdin and
+	// stdout are a terminal. Otherwise (candidates piped in, or running inside
+	// a shell function's command substitution) draw on /dev/tty, which also
+	// delivers keys and resize signals
+	var p *tea.Program
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return "", fmt.Errorf("no terminal available for the picker: %w", err)
+		}
+		defer tty.Close()
+		// Detect colors from the terminal rather than the redirected stdout
+		lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(tty))
+		p = tea.NewProgram(model, tea.WithInput(tty), tea.WithOutput(tty), tea.WithAltScreen())
+	} else {
+		p = tea.NewProgram(model, tea.WithAltScreen())
+	}
 
 	finalModel, err := p.Run()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		return "", err
 	}
 
 	if m, ok := finalModel.(tui.Model); ok {
-		if selected := m.Selected(); selected != "" {
-			fmt.Fprintf(os.Stderr, "BCD_SELECTED_PATH:%s\n", selected)
-		}
+		return m.Selected(), nil
 	}
+	return "", nil
+}
+
+// isTerminal reports whether f is attached to a terminal. Unlike checking
+// for a character device, this is false for /dev/null.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd())
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/sakolb/bcd/internal/bookmark"
+)
+
+// runMark implements `bcd mark NAME [path]`, bookmarking path (or the
+// current directory) as NAME.
+func runMark(args []string) int {
+	fs := flag.NewFlagSet("bcd mark", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd mark NAME [path]\n")
+	}
+	positional, err := parseSubcommand(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		fs.Usage()
+		return exitError
+	}
+
+	path := "."
+	if len(positional) == 2 {
+		path = positional[1]
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if _, err := os.Stat(abs); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	file, err := bookmark.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if err := bookmark.Add(file, positional[0], abs); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// runUnmark implements `bcd unmark NAME...`.
+func runUnmark(args []string) int {
+	fs := flag.NewFlagSet("bcd unmark", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd unmark NAME...\n")
+	}
+	names, err := parseSubcommand(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if len(names) == 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	file, err := bookmark.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	for _, name := range names {
+		if err := bookmark.Remove(file, name); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// runMarks implements `bcd marks`, listing bookmarks as aligned columns.
+func runMarks(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("bcd marks", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd marks\n")
+	}
+	if _, err := parseSubcommand(fs, args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	file, err := bookmark.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	bookmarks, err := bookmark.Load(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, b := range bookmarks {
+		fmt.Fprintf(tw, "%s\t%s\n", b.Name, b.Path)
+	}
+	if err := tw.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
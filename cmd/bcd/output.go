@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// nopCloser keeps a shared stream such as stdout open when the output
+// writer is closed.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// openOutput resolves the --output value. "-" is stdout, a number is an
+// already open file descriptor (e.g. --output 3 with 3>file in the shell),
+// and anything else is a file path that is created or truncated.
+func openOutput(spec string) (io.WriteCloser, error) {
+	if spec == "" || spec == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if fd, err := strconv.Atoi(spec); err == nil {
+		f := os.NewFile(uintptr(fd), "fd "+spec)
+		if f == nil {
+			return nil, fmt.Errorf("invalid output file descriptor %d", fd)
+		}
+		if _, err := f.Stat(); err != nil {
+			return nil, fmt.Errorf("output file descriptor %d: %w", fd, err)
+		}
+		return f, nil
+	}
+	return os.Create(spec)
+}
+
+// writeResult writes one result terminated by a newline, or by NUL when
+// print0 is set so that any byte sequence in a path survives.
+func writeResult(w io.Writer, path string, print0 bool) error {
+	term := "\n"
+	if print0 {
+		term = "\x00"
+	}
+	_, err := io.WriteString(w, path+term)
+	return err
+}
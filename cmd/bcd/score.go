@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/history"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+// runScore implements `bcd score QUERY PATH...`, explaining how each path
+// scores for QUERY as seen from the current directory.
+func runScore(args []string, w io.Writer) int {
+	fs := flag.NewFlagSet("bcd score", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: bcd score QUERY PATH... [--json]\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print the breakdowns as a JSON array")
+	weights := ranker.DefaultWeights()
+	fs.Func("weight", "set a ranking weight, `NAME=VALUE`, as for the picker", weights.ParseWeight)
+	markers := slices.Clone(project.DefaultMarkers)
+	fs.Func("marker", "also recognize projects by `FILE[:KIND]`", func(s string) error {
+		m, err := project.ParseMarker(s)
+		if err != nil {
+			return err
+		}
+		markers = append(markers, m)
+		return nil
+	})
+
+	// Scores use the weights and markers of the config files, as the
+	// picker's do, before those given here
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	settings, err := configFiles(cwd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	for _, s := range settings {
+		if s.Flag != "weight" && s.Flag != "marker" {
+			continue
+		}
+		if err := fs.Set(s.Flag, s.Value); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s: %v\n", s.Source, s.Flag, err)
+			return exitError
+		}
+	}
+
+	positional, err := parseSubcommand(fs, args)
+	if err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return exitError
+	}
+	// Paths visited through the cd hook get the history tab's bias
+	historyFile, _ := history.DefaultPath()
+	r := ranker.NewRankerWithBias(source.FrecencyBias(historyFile))
+	r.SetWeights(weights)
+	detect := source.DetectProject(markers)
+
+	query := positional[0]
+	explanations := make([]ranker.Explanation, 0, len(positional)-1)
+	for _, path := range positional[1:] {
+		e, err := scoreEntry(path, cwd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return exitError
+		}
+		detect(e)
+		explanations = append(explanations, r.Explain(query, e))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(explanations)
+	} else {
+		for i, x := range explanations {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if err = x.WriteText(w); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// scoreEntry builds the entry for path, relative to cwd, with the
+// metadata the ranking uses. Like candidates read from stdin, paths that
+// don't exist are scored as directories.
+func scoreEntry(path string, cwd string) (*entry.PathEntry, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(cwd, path)
+	}
+	path = filepath.Clean(path)
+	e, err := entry.NewPathEntry(path, cwd)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entry.NewPathEntryWithType(path, cwd, entry.FileTypeDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	e.LoadMetadata()
+	return e, nil
+}
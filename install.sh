@@ -112,28 +112,26 @@ setup_shell_integration() {
 }
 
 setup_bash() {
-    local rc_file="$HOME/.bashrc"
+    setup_posix_shell "Bash" "$HOME/.bashrc" bash
+}
+
+setup_zsh() {
+    setup_posix_shell "Zsh" "$HOME/.zshrc" zsh
+}
+
+# setup_posix_shell adds the PATH export and a line that loads the shell
+# integration generated by `bcd-bin init`, so the functions always match
+# the installed binary.
+setup_posix_shell() {
+    local shell_label="$1"
+    local rc_file="$2"
+    local shell_name="$3"
     local integration_marker="# bcd shell integration"
+    local integration_line="eval \"\$(bcd-bin init $shell_name)\""
     local path_export='export PATH="$HOME/.local/bin:$PATH"'
-    local script_dir="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
-    local integration_file="$script_dir/scripts/bcd.bash"
     local needs_source=false
 
-    # Check if bcd function already exists
-    if grep -q "$integration_marker" "$rc_file" 2>/dev/null; then
-        warn "bcd shell integration already exists in $rc_file"
-        echo "  Skipping function installation."
-    else
-        info "Adding Bash integration to $rc_file"
-        if [[ ! -f "$integration_file" ]]; then
-            error "Integration file not found: $integration_file"
-        fi
-        echo "" >> "$rc_file"
-        cat "$integration_file" >> "$rc_file"
-        needs_source=true
-    fi
-
-    # Check if PATH export is needed
+    # PATH must be set before the integration line runs bcd-bin
     if grep -q 'PATH.*\.local/bin' "$rc_file" 2>/dev/null; then
         info "~/.local/bin is already in PATH in $rc_file"
     else
@@ -142,77 +140,35 @@ setup_bash() {
         needs_source=true
     fi
 
-    if [ "$needs_source" = true ]; then
-        echo ""
-        info "Bash integration added!"
-        echo "  Run: source ~/.bashrc to start using bcd"
-    fi
-}
-
-setup_zsh() {
-    local rc_file="$HOME/.zshrc"
-    local integration_marker="# bcd shell integration"
-    local path_export='export PATH="$HOME/.local/bin:$PATH"'
-    local script_dir="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
-    local integration_file="$script_dir/scripts/bcd.zsh"
-    local needs_source=false
-
-    # Check if bcd function already exists
+    # Check if bcd integration already exists
     if grep -q "$integration_marker" "$rc_file" 2>/dev/null; then
         warn "bcd shell integration already exists in $rc_file"
         echo "  Skipping function installation."
     else
-        info "Adding Zsh integration to $rc_file"
-        if [[ ! -f "$integration_file" ]]; then
-            error "Integration file not found: $integration_file"
-        fi
+        info "Adding $shell_label integration to $rc_file"
         echo "" >> "$rc_file"
-        cat "$integration_file" >> "$rc_file"
-        needs_source=true
-    fi
-
-    # Check if PATH export is needed
-    if grep -q 'PATH.*\.local/bin' "$rc_file" 2>/dev/null; then
-        info "~/.local/bin is already in PATH in $rc_file"
-    else
-        info "Adding ~/.local/bin to PATH in $rc_file"
-        echo "$path_export" >> "$rc_file"
+        echo "$integration_marker" >> "$rc_file"
+        echo "$integration_line" >> "$rc_file"
         needs_source=true
     fi
 
     if [ "$needs_source" = true ]; then
         echo ""
-        info "Zsh integration added!"
-        echo "  Run: source ~/.zshrc to start using bcd"
+        info "$shell_label integration added!"
+        echo "  Run: source $rc_file to start using bcd"
     fi
 }
 
 setup_fish() {
-    local func_dir="$HOME/.config/fish/functions"
-    local func_file="$func_dir/bcd.fish"
     local config_file="$HOME/.config/fish/config.fish"
-    local script_dir="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
-    local integration_file="$script_dir/scripts/bcd.fish"
+    local integration_marker="# bcd shell integration"
+    local integration_line="bcd-bin init fish | source"
     local path_added=false
     local func_added=false
 
-    mkdir -p "$func_dir"
     mkdir -p "$HOME/.config/fish"
 
-    # Check if bcd function already exists
-    if [[ -f "$func_file" ]]; then
-        warn "bcd shell integration already exists at $func_file"
-        echo "  Skipping function installation."
-    else
-        info "Adding Fish integration to $func_file"
-        if [[ ! -f "$integration_file" ]]; then
-            error "Integration file not found: $integration_file"
-        fi
-        cat "$integration_file" > "$func_file"
-        func_added=true
-    fi
-
-    # Check if PATH export is needed
+    # PATH must be set before the integration line runs bcd-bin
     if grep -q 'fish_add_path.*\.local/bin' "$config_file" 2>/dev/null; then
         info "~/.local/bin is already in PATH in Fish config"
     else
@@ -221,6 +177,17 @@ setup_fish() {
         path_added=true
     fi
 
+    # Check if bcd integration already exists
+    if grep -q "$integration_marker" "$config_file" 2>/dev/null || [[ -f "$HOME/.config/fish/functions/bcd.fish" ]]; then
+        warn "bcd shell integration already exists in Fish config"
+        echo "  Skipping function installation."
+    else
+        info "Adding Fish integration to $config_file"
+        echo "$integration_marker" >> "$config_file"
+        echo "$integration_line" >> "$config_file"
+        func_added=true
+    fi
+
     if [ "$func_added" = true ] || [ "$path_added" = true ]; then
         echo ""
         info "Fish integration added!"
@@ -0,0 +1,165 @@
+// Package action describes what a key does to the entry under the cursor,
+// besides Enter selecting it: open it in $EDITOR or $PAGER, copy its path
+// to the clipboard, or run a user-defined shell command.
+//
+// Bindings are written KEY:ACTION, for example
+//
+//	ctrl+e:edit
+//	alt+p:page+exit
+//	ctrl+r:execute(git -C {} log)
+//	alt+o:become(xdg-open {})
+//
+// where {} stands for the selected path, quoted for the shell. Actions
+// return to the picker afterwards unless they end in +exit, or use become
+// instead of execute.
+package action
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Names of the built-in actions.
+const (
+	NameEdit    = "edit"
+	NamePage    = "page"
+	NameCopy    = "copy"
+	NameExecute = "execute"
+	NameBecome  = "become"
+)
+
+var ErrInvalidBinding = errors.New("invalid binding")
+
+type Action struct {
+	// Name is the action's name, shown in the help line.
+	Name string
+	// Command is the shell template run by sh, with {} standing for the
+	// quoted path. It is empty for copy, which runs no process.
+	Command string
+	// Exit ends the picker, without a selection, after the action ran.
+	Exit bool
+}
+
+// Bindings maps key names, as reported by Bubble Tea, to actions.
+type Bindings map[string]Action
+
+// DefaultBindings returns the actions bound when nothing is configured.
+func DefaultBindings() Bindings {
+	return Bindings{
+		"ctrl+e": mustParse(NameEdit),
+		"alt+p":  mustParse(NamePage),
+		"ctrl+y": mustParse(NameCopy),
+	}
+}
+
+// Keys returns the bound keys in a stable order.
+func (b Bindings) Keys() []string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParseBinding parses a KEY:ACTION binding.
+func ParseBinding(s string) (string, Action, error) {
+	key, spec, ok := strings.Cut(s, ":")
+	if !ok || key == "" {
+		return "", Action{}, fmt.Errorf("%w %q: expected KEY:ACTION", ErrInvalidBinding, s)
+	}
+	a, err := Parse(spec)
+	if err != nil {
+		return "", Action{}, err
+	}
+	return key, a, nil
+}
+
+// Parse parses an action: edit, page or copy, optionally followed by
+// +exit, or execute(COMMAND) and become(COMMAND).
+func Parse(spec string) (Action, error) {
+	for _, name := range []string{NameExecute, NameBecome} {
+		if command, ok := strings.CutPrefix(spec, name+"("); ok {
+			command, ok = strings.CutSuffix(command, ")")
+			if !ok || command == "" {
+				return Action{}, fmt.Errorf("%w %q: expected %s(COMMAND)", ErrInvalidBinding, spec, name)
+			}
+			return Action{Name: name, Command: command, Exit: name == NameBecome}, nil
+		}
+	}
+
+	name, exit := strings.CutSuffix(spec, "+exit")
+	a := Action{Name: name, Exit: exit}
+	switch name {
+	case NameEdit:
+		a.Command = `${VISUAL:-${EDITOR:-vi}} {}`
+	case NamePage:
+		a.Command = `${PAGER:-less} {}`
+	case NameCopy:
+	default:
+		return Action{}, fmt.Errorf("%w: unknown action %q", ErrInvalidBinding, spec)
+	}
+	return a, nil
+}
+
+// String returns the spec a was parsed from, as Parse accepts it.
+func (a Action) String() string {
+	switch a.Name {
+	case NameExecute, NameBecome:
+		return a.Name + "(" + a.Command + ")"
+	}
+	if a.Exit {
+		return a.Name + "+exit"
+	}
+	return a.Name
+}
+
+func mustParse(spec string) Action {
+	a, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// Expand replaces every {} in template with path, quoted for sh.
+func Expand(template string, path string) string {
+	return strings.ReplaceAll(template, "{}", Quote(path))
+}
+
+// Quote quotes s as a single sh word.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Cmd returns the process that runs a on path. It is nil for actions that
+// run no process.
+func (a Action) Cmd(path string) *exec.Cmd {
+	if a.Command == "" {
+		return nil
+	}
+	return exec.Command("sh", "-c", Expand(a.Command, path))
+}
+
+// OSC52 returns the escape sequence that asks the terminal to put text on
+// the system clipboard.
+func OSC52(text string) string {
+	return "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+}
+
+// Copy puts text on the clipboard through the controlling terminal, which
+// also works over SSH.
+func Copy(text string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	_, err = tty.WriteString(OSC52(text))
+	return err
+}
@@ -0,0 +1,60 @@
+package action
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestParseBinding(t *testing.T) {
+	tests := []struct {
+		binding string
+		key     string
+		want    Action
+	}{
+		{"ctrl+e:edit", "ctrl+e", Action{Name: NameEdit, Command: `${VISUAL:-${EDITOR:-vi}} {}`}},
+		{"alt+p:page+exit", "alt+p", Action{Name: NamePage, Command: `${PAGER:-less} {}`, Exit: true}},
+		{"ctrl+y:copy", "ctrl+y", Action{Name: NameCopy}},
+		{"ctrl+r:execute(git -C {} log)", "ctrl+r", Action{Name: NameExecute, Command: "git -C {} log"}},
+		{"alt+o:become(xdg-open {})", "alt+o", Action{Name: NameBecome, Command: "xdg-open {}", Exit: true}},
+	}
+
+	for _, tt := range tests {
+		key, a, err := ParseBinding(tt.binding)
+		if err != nil {
+			t.Errorf("ParseBinding(%q): unexpected error: %v", tt.binding, err)
+			continue
+		}
+		if key != tt.key || a != tt.want {
+			t.Errorf("ParseBinding(%q) = %q, %+v; want %q, %+v", tt.binding, key, a, tt.key, tt.want)
+		}
+		if spec := key + ":" + a.String(); spec != tt.binding {
+			t.Errorf("String() of %q = %q", tt.binding, spec)
+		}
+	}
+}
+
+func TestParseBindingInvalid(t *testing.T) {
+	for _, binding := range []string{"edit", ":edit", "ctrl+e:", "ctrl+e:open", "ctrl+e:execute()", "ctrl+e:execute(ls"} {
+		if _, _, err := ParseBinding(binding); !errors.Is(err, ErrInvalidBinding) {
+			t.Errorf("ParseBinding(%q): expected %v, got %v", binding, ErrInvalidBinding, err)
+		}
+	}
+}
+
+func TestExpandQuotesPath(t *testing.T) {
+	path := `/tmp/it's a "dir"`
+	out, err := exec.Command("sh", "-c", Expand("printf %s {}", path)).Output()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(out) != path {
+		t.Errorf("expected %q, got %q", path, out)
+	}
+}
+
+func TestOSC52(t *testing.T) {
+	if got := OSC52("/tmp"); got != "\x1b]52;c;L3RtcA==\a" {
+		t.Errorf("unexpected sequence %q", got)
+	}
+}
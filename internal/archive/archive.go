@@ -0,0 +1,370 @@
+// Package archive reads zip, jar and tar archives as if they were
+// directories: it lists their entries for the crawler, and extracts them
+// once one is selected.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/vfs"
+)
+
+// Sep separates the path of an archive from the path of an entry inside
+// it, as in /src/foo.zip!/inner/dir. The archive itself, as a directory,
+// is /src/foo.zip!.
+const Sep = "!"
+
+// ErrUnsupported is returned for files that are not an archive bcd reads.
+var ErrUnsupported = errors.New("not a zip, jar or tar archive")
+
+type format int
+
+const (
+	formatNone format = iota
+	formatZip
+	formatTar
+	formatTarGz
+)
+
+// formatOf tells the format of an archive from its name.
+func formatOf(name string) format {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".jar"):
+		return formatZip
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatTarGz
+	}
+	return formatNone
+}
+
+// IsArchive reports whether name is that of an archive bcd reads: .zip,
+// .jar, .tar, .tar.gz or .tgz.
+func IsArchive(name string) bool {
+	return formatOf(name) != formatNone
+}
+
+// Split splits path, when it is inside an archive, into the path of the
+// archive and the slash separated path of the entry inside it, "" for the
+// archive itself.
+func Split(p string) (archive string, inner string, ok bool) {
+	for i := 0; i < len(p); i++ {
+		j := strings.Index(p[i:], Sep)
+		if j < 0 {
+			break
+		}
+		i += j
+		rest := p[i+len(Sep):]
+		if IsArchive(p[:i]) && (rest == "" || rest[0] == '/') {
+			return p[:i], strings.TrimPrefix(rest, "/"), true
+		}
+	}
+	return "", "", false
+}
+
+// Inside reports whether path is inside an archive.
+func Inside(p string) bool {
+	_, _, ok := Split(p)
+	return ok
+}
+
+// Entry is an entry of an archive.
+type Entry struct {
+	// Name is the slash separated path of the entry in the archive
+	Name    string
+	Type    entry.FileType
+	ModTime time.Time
+
+	// perm is the permission bits the entry is extracted with
+	perm fs.FileMode
+	// link is the target of a symlink, only read when extracting
+	link string
+}
+
+// List returns the entries of the archive at path in fsys, sorted by name. The
+// directories archives leave out, only naming the files in them, are
+// listed as well. Entries that would land outside the archive, such as
+// ../x, are left out.
+func List(fsys vfs.FS, path string) ([]Entry, error) {
+	byName := make(map[string]Entry)
+	add := func(e Entry) {
+		name, ok := localName(e.Name)
+		if !ok {
+			return
+		}
+		e.Name = name
+		byName[name] = e
+		for dir := parentOf(name); dir != ""; dir = parentOf(dir) {
+			if _, ok := byName[dir]; ok {
+				break
+			}
+			byName[dir] = Entry{Name: dir, Type: entry.FileTypeDir}
+		}
+	}
+	if err := walk(fsys, path, false, func(e Entry, _ io.Reader) error {
+		add(e)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(byName))
+	for _, e := range byName {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return entries, nil
+}
+
+// Extract extracts the archive at path into dest, an existing directory.
+// Directories, regular files and symlinks to relative paths within the
+// archive are extracted; other links and devices are not, as they could
+// point outside of dest.
+func Extract(path string, dest string) error {
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+	return walk(vfs.OS, path, true, func(e Entry, r io.Reader) error {
+		name, ok := localName(e.Name)
+		if !ok {
+			return nil
+		}
+		switch {
+		case e.Type == entry.FileTypeDir:
+			return mkdirAll(root, name)
+		case e.Type == entry.FileTypeSymlink:
+			return symlink(root, dest, name, e.link)
+		case r != nil:
+			if dir := parentOf(name); dir != "" {
+				if err := mkdirAll(root, dir); err != nil {
+					return err
+				}
+			}
+			// Whatever the archive says, the owner can read and write what
+			// is extracted, to clean it up
+			f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, e.perm|0o600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, r)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// walk calls fn for each entry of the archive at path in fsys, in the
+// archive's order. With content set, regular files come with a reader of
+// their content; other entries, and every entry otherwise, with nil.
+func walk(fsys vfs.FS, path string, content bool, fn func(Entry, io.Reader) error) error {
+	format := formatOf(path)
+	if format == formatNone {
+		return &fs.PathError{Op: "open", Path: path, Err: ErrUnsupported}
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if format == formatZip {
+		return walkZip(f, path, content, fn)
+	}
+	return walkTar(f, path, format == formatTarGz, content, fn)
+}
+
+func walkZip(file fs.File, path string, content bool, fn func(Entry, io.Reader) error) error {
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	// Zip archives are read at random offsets, so files that cannot be are
+	// read in whole first
+	r, ok := file.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	zr, err := zip.NewReader(r, fi.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, f := range zr.File {
+		e := Entry{Name: f.Name, Type: typeOf(f.Mode()), ModTime: f.Modified, perm: f.Mode().Perm()}
+		if strings.HasSuffix(f.Name, "/") {
+			e.Type = entry.FileTypeDir
+		}
+		if content && e.Type == entry.FileTypeSymlink {
+			// A zipped symlink's content is its target
+			if e.link, err = readLink(f); err != nil {
+				return fmt.Errorf("%s%s/%s: %w", path, Sep, f.Name, err)
+			}
+		}
+		if !content || e.Type != entry.FileTypeFile {
+			if err := fn(e, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s%s/%s: %w", path, Sep, f.Name, err)
+		}
+		err = fn(e, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTar(file fs.File, path string, gzipped bool, content bool, fn func(Entry, io.Reader) error) error {
+	var r io.Reader = file
+	if gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		e := Entry{Name: hdr.Name, Type: entry.FileTypeFile, ModTime: hdr.ModTime, perm: hdr.FileInfo().Mode().Perm()}
+		var data io.Reader
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.Type = entry.FileTypeDir
+		case tar.TypeSymlink:
+			e.Type = entry.FileTypeSymlink
+			e.link = hdr.Linkname
+		case tar.TypeReg:
+			if content {
+				data = tr
+			}
+		case tar.TypeLink, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			// Listed as files, with nothing to extract
+		default:
+			continue
+		}
+		if err := fn(e, data); err != nil {
+			return err
+		}
+	}
+}
+
+// readLink reads the target of a zipped symlink.
+func readLink(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	target, err := io.ReadAll(io.LimitReader(r, 4096))
+	return string(target), err
+}
+
+// typeOf returns the entry type of an archived file of the given mode.
+func typeOf(mode fs.FileMode) entry.FileType {
+	switch {
+	case mode.IsDir():
+		return entry.FileTypeDir
+	case mode&fs.ModeSymlink != 0:
+		return entry.FileTypeSymlink
+	}
+	return entry.FileTypeFile
+}
+
+// localName cleans the name of an archived entry, reporting false when it
+// is empty or would be outside the archive.
+func localName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(name, "/"))
+	if name == "." || !filepath.IsLocal(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// parentOf returns the directory of a clean slash separated name, "" at
+// the top of the archive.
+func parentOf(name string) string {
+	i := strings.LastIndexByte(name, '/')
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// mkdirAll creates the directory name in root and its parents.
+func mkdirAll(root *os.Root, name string) error {
+	for i := 0; i <= len(name); i++ {
+		if i < len(name) && name[i] != '/' {
+			continue
+		}
+		err := root.Mkdir(name[:i], 0o755)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// symlink creates the symlink name in root, at dest, pointing to target.
+// It is skipped unless target is a relative path that stays in root, and
+// none of the directories it is in are links, which could take it out.
+func symlink(root *os.Root, dest string, name string, target string) error {
+	dir := parentOf(name)
+	if target == "" || path.IsAbs(target) || !filepath.IsLocal(path.Join(dir, target)) {
+		return nil
+	}
+	if dir != "" {
+		if err := mkdirAll(root, dir); err != nil {
+			return err
+		}
+		for d := dir; d != ""; d = parentOf(d) {
+			fi, err := root.Lstat(d)
+			if err != nil {
+				return err
+			}
+			if fi.Mode()&fs.ModeSymlink != 0 {
+				return nil
+			}
+		}
+	}
+	// os.Root can't create links, but dest is a directory extracted from
+	// nothing but regular directories down to name
+	return os.Symlink(target, filepath.Join(dest, filepath.FromSlash(name)))
+}
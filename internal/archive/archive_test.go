@@ -0,0 +1,198 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/vfs"
+)
+
+// files is the content of the archives tested: only files, as archives
+// often leave their directories out, and an entry escaping the archive.
+var files = map[string]string{
+	"release-1.0/README":          "read me",
+	"release-1.0/bin/tool":        "#!/bin/sh",
+	"release-1.0/logs/2024/a.log": "line",
+	"../escaped":                  "nope",
+}
+
+// links are the symlinks of the archives tested, to their targets: only
+// latest and dot stay inside the archive and are extracted. dot/up looks
+// like it does, but is out once dot is followed.
+var links = map[string]string{
+	"release-1.0/current": "/etc",
+	"release-1.0/dot":     ".",
+	"release-1.0/dot/up":  "../..",
+	"release-1.0/latest":  "logs/2024",
+	"release-1.0/up":      "../..",
+}
+
+func writeZip(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range sortedNames() {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	for _, name := range slices.Sorted(maps.Keys(links)) {
+		hdr := &zip.FileHeader{Name: name}
+		hdr.SetMode(fs.ModeSymlink | 0o777)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(links[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func writeTarGz(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedNames() {
+		hdr := &tar.Header{Name: name, Mode: 0o755, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[name]))
+	}
+	for _, name := range slices.Sorted(maps.Keys(links)) {
+		tw.WriteHeader(&tar.Header{Name: name, Linkname: links[name], Typeflag: tar.TypeSymlink})
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+}
+
+func sortedNames() []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "release.zip")
+	writeZip(t, zipPath)
+	tarPath := filepath.Join(dir, "release.tar.gz")
+	writeTarGz(t, tarPath)
+
+	want := []string{
+		"release-1.0 dir",
+		"release-1.0/README file",
+		"release-1.0/bin dir",
+		"release-1.0/bin/tool file",
+		"release-1.0/current symlink",
+		"release-1.0/dot symlink",
+		"release-1.0/dot/up symlink",
+		"release-1.0/latest symlink",
+		"release-1.0/logs dir",
+		"release-1.0/logs/2024 dir",
+		"release-1.0/logs/2024/a.log file",
+		"release-1.0/up symlink",
+	}
+	for _, path := range []string{zipPath, tarPath} {
+		entries, err := List(vfs.OS, path)
+		if err != nil {
+			t.Fatalf("List(%s): %v", path, err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name+" "+e.Type.String())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("List(%s):\n got %q\nwant %q", filepath.Base(path), got, want)
+		}
+	}
+}
+
+func TestListUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("hello"), 0o644)
+	if _, err := List(vfs.OS, path); err == nil {
+		t.Error("expected an error listing a text file")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"release.zip", "release.tgz"} {
+		path := filepath.Join(dir, name)
+		if name == "release.zip" {
+			writeZip(t, path)
+		} else {
+			writeTarGz(t, path)
+		}
+		dest := t.TempDir()
+		if err := Extract(path, dest); err != nil {
+			t.Fatalf("Extract(%s): %v", name, err)
+		}
+		for name, content := range files {
+			got, err := os.ReadFile(filepath.Join(dest, name))
+			if name == "../escaped" {
+				if err == nil {
+					t.Errorf("%s was extracted outside of dest", name)
+				}
+				continue
+			}
+			if err != nil || string(got) != content {
+				t.Errorf("%s: got %q, %v", name, got, err)
+			}
+		}
+		if got, err := os.ReadFile(filepath.Join(dest, "release-1.0/latest/a.log")); err != nil || string(got) != "line" {
+			t.Errorf("%s: expected the link inside the archive to be extracted, got %q, %v", name, got, err)
+		}
+		for _, link := range []string{"release-1.0/current", "release-1.0/dot/up", "release-1.0/up"} {
+			if _, err := os.Lstat(filepath.Join(dest, link)); err == nil {
+				t.Errorf("%s: expected %s, pointing outside, not to be extracted", name, link)
+			}
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, tt := range []struct {
+		path    string
+		archive string
+		inner   string
+		ok      bool
+	}{
+		{"/src/foo.zip!/inner/dir", "/src/foo.zip", "inner/dir", true},
+		{"/src/foo.tar.gz!", "/src/foo.tar.gz", "", true},
+		{"/src/wow!/foo.jar!/a", "/src/wow!/foo.jar", "a", true},
+		{"/src/foo.zip!x", "", "", false},
+		{"/src/foo.zip", "", "", false},
+		{"/src/hey!/there", "", "", false},
+	} {
+		archive, inner, ok := Split(tt.path)
+		if archive != tt.archive || inner != tt.inner || ok != tt.ok {
+			t.Errorf("Split(%q) = %q, %q, %v", tt.path, archive, inner, ok)
+		}
+	}
+	if !IsArchive("LOGS.TGZ") || IsArchive("notes.txt") {
+		t.Error("unexpected IsArchive")
+	}
+}
@@ -0,0 +1,134 @@
+// Package bookmark stores named directory bookmarks in the bcd config
+// directory. Writes go through datafile, so concurrent shells can add and
+// remove bookmarks safely.
+package bookmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sakolb/bcd/internal/datafile"
+)
+
+var (
+	ErrNotFound    = errors.New("bookmark not found")
+	ErrInvalidName = errors.New("invalid bookmark name")
+)
+
+type Bookmark struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// DefaultPath returns the bookmarks file location.
+func DefaultPath() (string, error) {
+	return datafile.ConfigPath("bookmarks.json")
+}
+
+// ValidateName rejects names that cannot be used as `bcd @NAME`.
+func ValidateName(name string) error {
+	if name == "" || strings.HasPrefix(name, "@") {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '/' {
+			return fmt.Errorf("%w: %q", ErrInvalidName, name)
+		}
+	}
+	return nil
+}
+
+// Load returns all bookmarks in file, sorted by name.
+func Load(file string) ([]Bookmark, error) {
+	data, err := datafile.Read(file)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// Get returns the bookmark called name.
+func Get(file string, name string) (Bookmark, error) {
+	bookmarks, err := Load(file)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	for _, b := range bookmarks {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return Bookmark{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Add stores a bookmark called name for the absolute path, replacing any
+// existing bookmark with the same name.
+func Add(file string, name string, path string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("bookmark path is not absolute: %s", path)
+	}
+	return datafile.Update(file, func(data []byte) ([]byte, error) {
+		bookmarks, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		kept := bookmarks[:0]
+		for _, b := range bookmarks {
+			if b.Name != name {
+				kept = append(kept, b)
+			}
+		}
+		return encode(append(kept, Bookmark{Name: name, Path: filepath.Clean(path)}))
+	})
+}
+
+// Remove deletes the bookmark called name.
+func Remove(file string, name string) error {
+	return datafile.Update(file, func(data []byte) ([]byte, error) {
+		bookmarks, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		kept := bookmarks[:0]
+		for _, b := range bookmarks {
+			if b.Name != name {
+				kept = append(kept, b)
+			}
+		}
+		if len(kept) == len(bookmarks) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return encode(kept)
+	})
+}
+
+func decode(data []byte) ([]Bookmark, error) {
+	var bookmarks []Bookmark
+	if len(data) == 0 {
+		return bookmarks, nil
+	}
+	if err := json.Unmarshal(data, &bookmarks); err != nil {
+		return nil, err
+	}
+	sortByName(bookmarks)
+	return bookmarks, nil
+}
+
+func encode(bookmarks []Bookmark) ([]byte, error) {
+	sortByName(bookmarks)
+	return json.MarshalIndent(bookmarks, "", "  ")
+}
+
+func sortByName(bookmarks []Bookmark) {
+	sort.Slice(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Name < bookmarks[j].Name
+	})
+}
@@ -0,0 +1,61 @@
+package bookmark
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddGetRemove(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bookmarks.json")
+
+	if err := Add(file, "src", "/home/user/src"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := Add(file, "docs", "/home/user/docs"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Re-adding a name replaces its path
+	if err := Add(file, "src", "/srv/src"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bookmarks, err := Load(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bookmarks) != 2 || bookmarks[0].Name != "docs" || bookmarks[1].Name != "src" {
+		t.Fatalf("expected docs and src sorted by name, got %+v", bookmarks)
+	}
+
+	b, err := Get(file, "src")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.Path != "/srv/src" {
+		t.Errorf("expected /srv/src, got %s", b.Path)
+	}
+
+	if err := Remove(file, "src"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Get(file, "src"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+	if err := Remove(file, "src"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestAddRejectsInvalidInput(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bookmarks.json")
+
+	for _, name := range []string{"", "@src", "my src", "a/b"} {
+		if err := Add(file, name, "/tmp"); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Add(%q): expected %v, got %v", name, ErrInvalidName, err)
+		}
+	}
+	if err := Add(file, "rel", "relative/path"); err == nil {
+		t.Error("expected error for relative path")
+	}
+}
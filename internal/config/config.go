@@ -0,0 +1,380 @@
+// Package config loads bcd's settings. A setting is one of the picker's
+// command line flags, given a value in one of these layers, each of which
+// overrides the ones before it:
+//
+//  1. the defaults
+//  2. $XDG_CONFIG_HOME/bcd/config.toml, the user's config file
+//  3. .bcd.toml in the base directory, for settings that only apply there,
+//     limited to those in DirFlags
+//  4. the BCD_DEFAULT_OPTS environment variable, as flags
+//  5. the command line flags
+//
+// The config files use the flags' names as keys. Flags that take NAME=VALUE
+// or KEY:ACTION pairs have a table of their own instead, see Tables.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sakolb/bcd/internal/datafile"
+)
+
+const (
+	// EnvVar holds flags applied before those of the command line.
+	EnvVar = "BCD_DEFAULT_OPTS"
+	// DirFile is the name of the config file read from the base directory.
+	DirFile = ".bcd.toml"
+)
+
+// Where a setting came from, besides the config files, which are named by
+// their path.
+const (
+	SourceDefault = "default"
+	SourceEnv     = EnvVar
+	SourceFlags   = "command line"
+)
+
+// Table maps a table of a config file to a flag taking pairs: each key k
+// with value v is the flag's value k + Sep + v.
+type Table struct {
+	Flag string
+	Sep  string
+}
+
+// Tables are the tables a config file may have, by name.
+var Tables = map[string]Table{
+	"weights": {Flag: "weight", Sep: "="},
+	"theme":   {Flag: "theme", Sep: "="},
+	"keymap":  {Flag: "bind", Sep: ":"},
+}
+
+// DirFlags are the flags a directory's config file may set. That file
+// comes with the directory, a cloned repository for instance, so it may
+// only change what is listed and how it is shown: not key bindings, which
+// run commands, nor how the result is handed back.
+var DirFlags = map[string]bool{
+	"type":      true,
+	"repos":     true,
+	"projects":  true,
+	"marker":    true,
+	"ignore":    true,
+	"long":      true,
+	"sort":      true,
+	"weight":    true,
+	"theme":     true,
+	"explain":   true,
+	"archives":  true,
+	"no-daemon": true,
+	"no-watch":  true,
+}
+
+// Setting is a value for a flag.
+type Setting struct {
+	Flag  string
+	Value string
+	// Source is where the setting came from: the path of a config file,
+	// or SourceEnv
+	Source string
+}
+
+// DefaultPath returns the user's config file location.
+func DefaultPath() (string, error) {
+	return datafile.ConfigPath("config.toml")
+}
+
+// DirPath returns the location of the config file of dir.
+func DirPath(dir string) string {
+	return filepath.Join(dir, DirFile)
+}
+
+// ReadFile returns the settings of the config file at path, in the order
+// they appear, or nil if it does not exist.
+func ReadFile(path string) ([]Setting, error) {
+	data, err := datafile.Read(path)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return Parse(data, path)
+}
+
+// ReadDirFile returns the settings of the config file of dir, as ReadFile
+// does, failing on any that DirFlags does not allow.
+func ReadDirFile(dir string) ([]Setting, error) {
+	settings, err := ReadFile(DirPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range settings {
+		if !DirFlags[s.Flag] {
+			return nil, fmt.Errorf("%s: %s can only be set in your own config file", s.Source, settingName(s.Flag))
+		}
+	}
+	return settings, nil
+}
+
+// settingName returns how a config file sets flag: its table when it has
+// one, or its name.
+func settingName(flag string) string {
+	for name, table := range Tables {
+		if table.Flag == flag {
+			return "[" + name + "]"
+		}
+	}
+	return flag
+}
+
+// Parse returns the settings of a config file, in the order they appear.
+// An array sets a flag once for each of its elements.
+func Parse(data []byte, source string) ([]Setting, error) {
+	var doc map[string]any
+	md, err := toml.Decode(string(data), &doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	var settings []Setting
+	for _, key := range md.Keys() {
+		switch len(key) {
+		case 1:
+			v := doc[key[0]]
+			if _, ok := v.(map[string]any); ok {
+				if _, ok := Tables[key[0]]; !ok {
+					return nil, fmt.Errorf("%s: unknown table [%s]", source, key[0])
+				}
+				continue
+			}
+			values, err := scalars(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", source, key, err)
+			}
+			for _, value := range values {
+				settings = append(settings, Setting{Flag: key[0], Value: value, Source: source})
+			}
+		case 2:
+			table, ok := Tables[key[0]]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown table [%s]", source, key[0])
+			}
+			v := doc[key[0]].(map[string]any)[key[1]]
+			if _, ok := v.(map[string]any); ok {
+				return nil, fmt.Errorf("%s: %s: too deeply nested", source, key)
+			}
+			values, err := scalars(v)
+			if err == nil && len(values) != 1 {
+				err = errors.New("expected a single value")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", source, key, err)
+			}
+			settings = append(settings, Setting{Flag: table.Flag, Value: key[1] + table.Sep + values[0], Source: source})
+		default:
+			return nil, fmt.Errorf("%s: %s: too deeply nested", source, key)
+		}
+	}
+	return settings, nil
+}
+
+// scalars returns v as flag values: itself if it is a string, number or
+// boolean, or its elements if it is an array of those.
+func scalars(v any) ([]string, error) {
+	if array, ok := v.([]any); ok {
+		values := make([]string, 0, len(array))
+		for _, elem := range array {
+			s, err := scalar(elem)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	s, err := scalar(v)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+func scalar(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v (expected a string, number, boolean or an array of them)", v)
+}
+
+// Env returns the flags in BCD_DEFAULT_OPTS.
+func Env() ([]string, error) {
+	args, err := SplitArgs(os.Getenv(EnvVar))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", EnvVar, err)
+	}
+	return args, nil
+}
+
+// SplitArgs splits s into words the way sh does, minus expansions: words
+// are separated by blanks, which single and double quotes or a backslash
+// make part of a word.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// Flags records where the flags of a FlagSet were last set from. Setting
+// a flag through the FlagSet, by parsing arguments or calling Set, records
+// the current source.
+type Flags struct {
+	fs      *flag.FlagSet
+	source  string
+	sources map[string]string
+	keyed   map[string]string
+	resets  map[string]func()
+}
+
+// Track starts recording the sources of the flags defined in fs so far.
+func Track(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		fs:      fs,
+		source:  SourceFlags,
+		sources: make(map[string]string),
+		keyed:   make(map[string]string),
+		resets:  make(map[string]func()),
+	}
+	fs.VisitAll(func(fl *flag.Flag) {
+		fl.Value = &tracked{Value: fl.Value, name: fl.Name, flags: f}
+	})
+	return f
+}
+
+// Keyed records a source for each key of the values of flag name, which
+// are KEY + sep + VALUE, or the whole value if sep is empty.
+func (f *Flags) Keyed(name string, sep string) {
+	f.keyed[name] = sep
+}
+
+// Replace makes a source setting flag name replace the value set by the
+// sources before it, by calling reset first, rather than add to it.
+func (f *Flags) Replace(name string, reset func()) {
+	f.resets[name] = reset
+}
+
+// From makes source the source of the flags set from now on.
+func (f *Flags) From(source string) {
+	f.source = source
+}
+
+// Apply sets the flags of settings, each from its source.
+func (f *Flags) Apply(settings []Setting) error {
+	for _, s := range settings {
+		if f.fs.Lookup(s.Flag) == nil {
+			return fmt.Errorf("%s: unknown setting %q", s.Source, s.Flag)
+		}
+		f.From(s.Source)
+		if err := f.fs.Set(s.Flag, s.Value); err != nil {
+			return fmt.Errorf("%s: %s: %w", s.Source, s.Flag, err)
+		}
+	}
+	return nil
+}
+
+// Source returns where flag name was last set from, or SourceDefault.
+func (f *Flags) Source(name string) string {
+	if source, ok := f.sources[name]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// KeySource returns where the value for key of a Keyed flag was last set
+// from, or SourceDefault.
+func (f *Flags) KeySource(name string, key string) string {
+	return f.Source(name + "." + key)
+}
+
+type tracked struct {
+	flag.Value
+	name  string
+	flags *Flags
+}
+
+func (t *tracked) Set(value string) error {
+	f := t.flags
+	if reset, ok := f.resets[t.name]; ok && f.Source(t.name) != f.source {
+		reset()
+	}
+	if err := t.Value.Set(value); err != nil {
+		return err
+	}
+	f.sources[t.name] = f.source
+	if sep, ok := f.keyed[t.name]; ok {
+		key := value
+		if sep != "" {
+			key, _, _ = strings.Cut(value, sep)
+		}
+		f.sources[t.name+"."+strings.TrimSpace(key)] = f.source
+	}
+	return nil
+}
+
+// IsBoolFlag lets boolean flags go without a value, as they did before.
+func (t *tracked) IsBoolFlag() bool {
+	b, ok := t.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
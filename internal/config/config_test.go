@@ -0,0 +1,199 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := `
+sort = "mtime"
+long = true
+ignore = ["node_modules", "*.o"]
+
+[weights]
+recency = 30
+half-life = "72h"
+
+[keymap]
+"ctrl+o" = "execute(git -C {} status)"
+`
+	got, err := Parse([]byte(data), "config.toml")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Setting{
+		{"sort", "mtime", "config.toml"},
+		{"long", "true", "config.toml"},
+		{"ignore", "node_modules", "config.toml"},
+		{"ignore", "*.o", "config.toml"},
+		{"weight", "recency=30", "config.toml"},
+		{"weight", "half-life=72h", "config.toml"},
+		{"bind", "ctrl+o:execute(git -C {} status)", "config.toml"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		want string
+	}{
+		{"sort =", "expected value"},
+		{"[colors]\nmatch = 1", "unknown table [colors]"},
+		{"[weights]\nproject = [1, 2]", "single value"},
+		{"[weights.project]\nx = 1", "too deeply nested"},
+		{"type = [[\"d\"]]", "unsupported value"},
+	} {
+		_, err := Parse([]byte(tt.data), "config.toml")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q): expected an error containing %q, got %v", tt.data, tt.want, err)
+		}
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	settings, err := ReadFile(filepath.Join(t.TempDir(), DirFile))
+	if settings != nil || err != nil {
+		t.Errorf("expected no settings and no error, got %v, %v", settings, err)
+	}
+}
+
+func TestReadDirFile(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		want string
+	}{
+		{"sort = \"name\"\nignore = [\"vendor\"]\n\n[weights]\nproject = 40", ""},
+		{"[keymap]\nenter = \"execute(touch /tmp/pwned)\"", "[keymap] can only be set in your own config file"},
+		{"bind = \"enter:become(sh)\"", "[keymap] can only be set"},
+		{"print0 = true", "print0 can only be set"},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(DirPath(dir), []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		settings, err := ReadDirFile(dir)
+		switch {
+		case tt.want == "" && (err != nil || len(settings) != 3):
+			t.Errorf("ReadDirFile(%q) = %v, %v", tt.data, settings, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("ReadDirFile(%q): expected an error containing %q, got %v", tt.data, tt.want, err)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  --long\t--sort mtime ", []string{"--long", "--sort", "mtime"}},
+		{`--bind 'ctrl+o:execute(git -C {} log)'`, []string{"--bind", "ctrl+o:execute(git -C {} log)"}},
+		{`--ignore "my dir" a\ b ''`, []string{"--ignore", "my dir", "a b", ""}},
+		{`"it's" 'say "hi"'`, []string{"it's", `say "hi"`}},
+	} {
+		got, err := SplitArgs(tt.in)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`'open`, `"open`, `trailing\`} {
+		if _, err := SplitArgs(in); err == nil {
+			t.Errorf("SplitArgs(%q): expected an error", in)
+		}
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv(EnvVar, "--sort name")
+	args, err := Env()
+	if err != nil || !reflect.DeepEqual(args, []string{"--sort", "name"}) {
+		t.Errorf("Env() = %q, %v", args, err)
+	}
+	os.Unsetenv(EnvVar)
+	if args, err := Env(); args != nil || err != nil {
+		t.Errorf("Env() without %s = %q, %v", EnvVar, args, err)
+	}
+}
+
+func TestFlagsLayers(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	sort := fs.String("sort", "score", "")
+	long := fs.Bool("long", false, "")
+	var types, weights []string
+	fs.Func("type", "", func(s string) error { types = append(types, s); return nil })
+	fs.Func("weight", "", func(s string) error { weights = append(weights, s); return nil })
+
+	f := Track(fs)
+	f.Keyed("weight", "=")
+	f.Replace("type", func() { types = nil })
+
+	err := f.Apply([]Setting{
+		{"sort", "mtime", "config.toml"},
+		{"type", "d", "config.toml"},
+		{"type", "l", "config.toml"},
+		{"weight", "project=30", "config.toml"},
+		{"weight", "recency=5", ".bcd.toml"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.From(SourceEnv)
+	if err := fs.Parse([]string{"--long", "--type", "f"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.From(SourceFlags)
+	if err := fs.Parse([]string{"--weight", "project=40"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *sort != "mtime" || !*long {
+		t.Errorf("sort = %q, long = %t", *sort, *long)
+	}
+	// A later source replaces the types, but its own values add up
+	if !reflect.DeepEqual(types, []string{"f"}) {
+		t.Errorf("types = %q, want [f]", types)
+	}
+	if !reflect.DeepEqual(weights, []string{"project=30", "recency=5", "project=40"}) {
+		t.Errorf("weights = %q", weights)
+	}
+	for _, tt := range []struct {
+		got, want string
+	}{
+		{f.Source("sort"), "config.toml"},
+		{f.Source("long"), SourceEnv},
+		{f.Source("type"), SourceEnv},
+		{f.Source("weight"), SourceFlags},
+		{f.KeySource("weight", "project"), SourceFlags},
+		{f.KeySource("weight", "recency"), ".bcd.toml"},
+		{f.KeySource("weight", "half-life"), SourceDefault},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("source %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestFlagsApplyErrors(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("depth", 0, "")
+	f := Track(fs)
+	if err := f.Apply([]Setting{{"sortt", "x", "config.toml"}}); err == nil || !strings.Contains(err.Error(), `unknown setting "sortt"`) {
+		t.Errorf("expected an unknown setting error, got %v", err)
+	}
+	err := f.Apply([]Setting{{"depth", "deep", "config.toml"}})
+	if err == nil || !strings.HasPrefix(err.Error(), "config.toml: depth: ") {
+		t.Errorf("expected an invalid value error, got %v", err)
+	}
+	if f.Source("depth") != SourceDefault {
+		t.Errorf("a failed setting should not be recorded, got %q", f.Source("depth"))
+	}
+}
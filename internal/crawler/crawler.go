@@ -4,31 +4,157 @@
 package crawler
 
 import (
-	"os"
+	"errors"
+	"io/fs"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sakolb/bcd/internal/archive"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/vfs"
 )
 
+// Path is a path found by the crawler.
+type Path struct {
+	Path string
+	Type entry.FileType
+	// Project is the kind of project a directory is the root of, or ""
+	Project string
+	// ModTime is when a directory was last modified; zero for other types
+	// and directories that could not be read
+	ModTime time.Time
+}
+
 type Crawler struct {
-	pathChan     chan string
+	pathChan     chan Path
 	errChan      chan error
 	done         chan struct{}
+	stopOnce     sync.Once
 	skipHidden   bool
 	maxDepth     int
 	ignoreErrors bool
+	types        map[entry.FileType]bool
+	markers      *project.Matcher
+	ignore       []string
+	archives     bool
+	fsys         vfs.FS
+
+	// Progress counters, updated by Crawl and read by Stats
+	started          atomic.Int64
+	finished         atomic.Int64
+	dirs             atomic.Int64
+	files            atomic.Int64
+	depth            atomic.Int64
+	permissionDenied atomic.Int64
+	failed           atomic.Int64
+}
+
+type Options struct {
+	// IgnoreErrors drops errors instead of sending them on Errors. When it
+	// is false, the caller must drain Errors or the crawl blocks.
+	IgnoreErrors bool
+	// Types restricts the paths sent on Paths to these file types. Every
+	// directory is still traversed. Nil sends every type.
+	Types []entry.FileType
+	// Markers recognize project roots, reported on the directories sent.
+	Markers []project.Marker
+	// Ignore skips the entries whose name matches one of these patterns, in
+	// filepath.Match syntax: they are neither sent nor traversed.
+	Ignore []string
+	// Archives descends into the zip, jar and tar archives found, as if
+	// they were directories: an archive's entries are sent below its path
+	// and archive.Sep, as in /src/foo.zip!/inner/dir.
+	Archives bool
+	// FS is the filesystem crawled; nil is the operating system's.
+	FS vfs.FS
+}
+
+func DefaultOptions() Options {
+	return Options{
+		IgnoreErrors: true,
+	}
 }
 
 func NewCrawler() *Crawler {
-	return &Crawler{
-		pathChan:     make(chan string, 1000),
+	return NewCrawlerWithOptions(DefaultOptions())
+}
+
+func NewCrawlerWithOptions(opts Options) *Crawler {
+	c := &Crawler{
+		pathChan:     make(chan Path, 1000),
 		errChan:      make(chan error, 20),
 		done:         make(chan struct{}),
 		skipHidden:   false,
 		maxDepth:     -1,
-		ignoreErrors: true,
+		ignoreErrors: opts.IgnoreErrors,
+		markers:      project.NewMatcher(opts.Markers),
+		ignore:       opts.Ignore,
+		archives:     opts.Archives,
+		fsys:         vfs.Or(opts.FS),
+	}
+	if len(opts.Types) > 0 {
+		c.types = make(map[entry.FileType]bool, len(opts.Types))
+		for _, t := range opts.Types {
+			c.types[t] = true
+		}
+	}
+	return c
+}
+
+// Stats is a snapshot of a crawl's progress.
+type Stats struct {
+	// Dirs counts the directories read so far, Files the other entries found
+	Dirs  int64
+	Files int64
+	// Depth is the BFS level of the directory being read, counted in steps
+	// from the base directory, up or down
+	Depth int
+	// PermissionDenied counts directories that could not be read for lack
+	// of permission, Errors every other failure
+	PermissionDenied int64
+	Errors           int64
+	Elapsed          time.Duration
+	Done             bool
+}
+
+// Stats returns the crawl's progress so far. It is safe to call from any
+// goroutine while Crawl runs.
+func (c *Crawler) Stats() Stats {
+	s := Stats{
+		Dirs:             c.dirs.Load(),
+		Files:            c.files.Load(),
+		Depth:            int(c.depth.Load()),
+		PermissionDenied: c.permissionDenied.Load(),
+		Errors:           c.failed.Load(),
+	}
+	started := c.started.Load()
+	if started == 0 {
+		return s
+	}
+	end := time.Now().UnixNano()
+	if finished := c.finished.Load(); finished != 0 {
+		end = finished
+		s.Done = true
+	}
+	s.Elapsed = time.Duration(end - started)
+	return s
+}
+
+// Rate returns the number of entries found per second.
+func (s Stats) Rate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
 	}
+	return float64(s.Dirs+s.Files) / s.Elapsed.Seconds()
 }
 
-func (c *Crawler) Paths() <-chan string {
+func (c *Crawler) Paths() <-chan Path {
 	return c.pathChan
 }
 
@@ -36,65 +162,279 @@ func (c *Crawler) Errors() <-chan error {
 	return c.errChan
 }
 
+// Done is closed once the crawler has been stopped.
 func (c *Crawler) Done() <-chan struct{} {
 	return c.done
 }
 
+// Stop ends a running Crawl early, closing its channels. It is safe to
+// call more than once, and from any goroutine.
+func (c *Crawler) Stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+}
+
+// send passes p on c.pathChan, giving up if the crawler is stopped first.
+// Paths of a type that was not asked for are skipped. It reports whether
+// the crawl should go on.
+func (c *Crawler) send(p Path) bool {
+	if c.types != nil && !c.types[p.Type] {
+		return true
+	}
+	select {
+	case c.pathChan <- p:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
 // Crawl crawls the directory from basedDir
 // using BFS traversal. Any error, encountered are
 // sent on the c.errChan channel. All path
-// discovered will be send to c.pathChan channel.
+// discovered will be send to c.pathChan channel,
+// directories once their content has been read so
+// that project roots can be recognized.
+// The crawl ends early once Stop is called.
 func (c *Crawler) Crawl(baseDir string) {
+	c.crawl(baseDir, false)
+}
+
+// CrawlAbove crawls what Crawl(dir) would find outside of dir, in the
+// same order: dir and everything below it are left out, for when they are
+// known already.
+func (c *Crawler) CrawlAbove(dir string) {
+	c.crawl(dir, true)
+}
+
+// crawl crawls from baseDir, starting with its parent when above is set.
+func (c *Crawler) crawl(baseDir string, above bool) {
+	c.started.Store(time.Now().UnixNano())
 	defer close(c.pathChan)
 	defer close(c.errChan)
+	// Done by the time the channels close, with the time it was done
+	defer func() { c.finished.Store(time.Now().UnixNano()) }()
 	absDir, err := filepath.Abs(baseDir)
 	if err != nil {
-		if !c.ignoreErrors {
-			c.errChan <- err
-		}
+		c.report(err)
 		return
 	}
-	queue := make([]string, 0)
-	visited := make(map[string]bool)
-	queue = append(queue, absDir)
-	visited[absDir] = true
-	c.pathChan <- absDir
+	// The queue holds interned paths, which share their parents with the
+	// other directories queued
+	type queued struct {
+		path  entry.Path
+		depth int
+		// from is the directory an ancestor of the base was reached from,
+		// already crawled; it is zero below the base
+		from entry.Path
+		up   bool
+		// archive is set for archives, read in turn like directories
+		archive bool
+	}
+	queue := make([]queued, 0)
+	start := queued{path: entry.MakePath(absDir), up: true}
+	if above {
+		parent := start.path.Dir()
+		if parent == start.path {
+			return
+		}
+		start = queued{path: parent, depth: 1, from: start.path, up: true}
+	}
+	queue = append(queue, start)
 	for len(queue) != 0 {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
 		current := queue[0]
 		queue = queue[1:]
-		neighbors, err := c.getNeighbor(current)
-		if err != nil {
-			if !c.ignoreErrors {
-				c.errChan <- err
+		c.depth.Store(int64(current.depth))
+		if current.archive {
+			if !c.crawlArchive(current.path.String()) {
+				return
 			}
+			continue
+		}
+		c.dirs.Add(1)
+		// Below the base, every directory is reached once, from its parent,
+		// so there is no need to remember the directories visited
+		children, archives, ok := c.getChildren(current.path)
+		if !ok {
+			return
 		}
-		for _, neighbor := range neighbors {
-			if !visited[neighbor] {
-				visited[neighbor] = true
-				queue = append(queue, neighbor)
-				c.pathChan <- neighbor
+		for _, child := range children {
+			if child != current.from {
+				queue = append(queue, queued{path: child, depth: current.depth + 1})
 			}
 		}
+		for _, a := range archives {
+			queue = append(queue, queued{path: a, depth: current.depth + 1, archive: true})
+		}
+		if parent := current.path.Dir(); current.up && parent != current.path {
+			queue = append(queue, queued{path: parent, depth: current.depth + 1, from: current.path, up: true})
+		}
+	}
+}
+
+// report counts err and passes it on c.errChan unless errors are ignored.
+func (c *Crawler) report(err error) {
+	if errors.Is(err, fs.ErrPermission) {
+		c.permissionDenied.Add(1)
+	} else {
+		c.failed.Add(1)
+	}
+	if c.ignoreErrors {
+		return
+	}
+	select {
+	case c.errChan <- err:
+	case <-c.done:
 	}
 }
 
-// getNeigbor take a directory path (absolute path)
-// returns a list of string containing its neighbor directories, and
-// an error. Neighbor directories are any directory that is either a direct
-// child and parent directory. It passes the path of any children
-// entries that are files into crawler's pathChan channel.
-func (c *Crawler) getNeighbor(dir string) ([]string, error) {
-	var neighbors []string
-	children, err := os.ReadDir(dir)
+// getChildren takes a directory path and returns its child directories,
+// the archives in it to descend into, and whether the crawl should go on.
+// It passes dir itself, then the path of any children entries that are
+// files into crawler's pathChan channel.
+func (c *Crawler) getChildren(path entry.Path) ([]entry.Path, []entry.Path, bool) {
+	var dirs, archives []string
+	dir := path.String()
+	children, modTime, err := readDir(c.fsys, dir)
+	if err != nil {
+		c.report(err)
+	}
+
+	p := Path{Path: dir, Type: entry.FileTypeDir, ModTime: modTime}
+	if c.markers != nil {
+		names := make([]string, len(children))
+		for i, child := range children {
+			names[i] = child.Name()
+		}
+		p.Project = c.markers.Kind(names)
+	}
+	if !c.send(p) {
+		return nil, nil, false
+	}
+
 	for _, child := range children {
-		childPath := filepath.Join(dir, child.Name())
+		if c.ignored(child.Name()) {
+			continue
+		}
 		if child.IsDir() {
-			neighbors = append(neighbors, childPath)
+			dirs = append(dirs, child.Name())
+		} else {
+			c.files.Add(1)
+			t := entry.FileTypeFile
+			if child.Type()&fs.ModeSymlink != 0 {
+				t = entry.FileTypeSymlink
+			}
+			if !c.send(Path{Path: filepath.Join(dir, child.Name()), Type: t}) {
+				return nil, nil, false
+			}
+			if c.archives && child.Type().IsRegular() && archive.IsArchive(child.Name()) {
+				archives = append(archives, child.Name())
+			}
+		}
+	}
+	return path.JoinEach(dirs), path.JoinEach(archives), true
+}
+
+// crawlArchive passes the entries of the archive at path into pathChan,
+// as if it were a directory called path and archive.Sep: that directory
+// first, then every entry in it, and reports whether the crawl should go
+// on. An archive that cannot be read is reported like a directory.
+func (c *Crawler) crawlArchive(path string) bool {
+	entries, err := archive.List(c.fsys, path)
+	if err != nil {
+		c.report(err)
+		return true
+	}
+	// Directories are sent with the project they are the root of, as
+	// those on disk, which takes the names of their children
+	var children map[string][]string
+	if c.markers != nil {
+		children = make(map[string][]string)
+		for _, e := range entries {
+			parent, name := "", e.Name
+			if i := strings.LastIndexByte(e.Name, '/'); i >= 0 {
+				parent, name = e.Name[:i], e.Name[i+1:]
+			}
+			children[parent] = append(children[parent], name)
+		}
+	}
+
+	root := path + archive.Sep
+	p := Path{Path: root, Type: entry.FileTypeDir}
+	if c.markers != nil {
+		p.Project = c.markers.Kind(children[""])
+	}
+	c.dirs.Add(1)
+	if !c.send(p) {
+		return false
+	}
+	for _, e := range entries {
+		if c.ignoredWithin(e.Name) {
+			continue
+		}
+		p := Path{Path: root + "/" + e.Name, Type: e.Type}
+		if e.Type == entry.FileTypeDir {
+			c.dirs.Add(1)
+			p.ModTime = e.ModTime
+			if c.markers != nil {
+				p.Project = c.markers.Kind(children[e.Name])
+			}
 		} else {
-			c.pathChan <- childPath
+			c.files.Add(1)
+		}
+		if !c.send(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ignored reports whether name matches one of the ignore patterns.
+func (c *Crawler) ignored(name string) bool {
+	for _, pattern := range c.ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredWithin reports whether an element of the slash separated name
+// matches one of the ignore patterns, as the entries in ignored
+// directories are not crawled either.
+func (c *Crawler) ignoredWithin(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if c.ignored(elem) {
+			return true
 		}
 	}
-	parent := filepath.Dir(dir)
-	neighbors = append(neighbors, parent)
-	return neighbors, err
+	return false
+}
+
+// readDir reads the entries of dir sorted by name, like os.ReadDir, and its
+// modification time. The stat goes through the open directory, which is
+// cheaper than another lookup by path.
+func readDir(fsys vfs.FS, dir string) ([]fs.DirEntry, time.Time, error) {
+	f, err := fsys.Open(dir)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	var modTime time.Time
+	if fi, err := f.Stat(); err == nil {
+		modTime = fi.ModTime()
+	}
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, modTime, &fs.PathError{Op: "readdirent", Path: dir, Err: syscall.ENOTDIR}
+	}
+	children, err := d.ReadDir(-1)
+	slices.SortFunc(children, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return children, modTime, err
 }
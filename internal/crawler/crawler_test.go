@@ -0,0 +1,328 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/vfs"
+)
+
+// newTree returns a small tree in memory, to crawl from /home/user/src.
+func newTree() *vfs.Mem {
+	mem := vfs.NewMem()
+	mem.WriteFile("/home/user/src/go.mod", nil)
+	mem.Symlink("/home/user/src/latest")
+	mem.WriteFile("/home/user/src/a/x.go", nil)
+	mem.Mkdir("/home/user/src/b")
+	mem.WriteFile("/home/user/docs/readme.md", nil)
+	mem.WriteFile("/etc/hosts", nil)
+	return mem
+}
+
+// crawl crawls from base with opts, and returns the paths sent, as their
+// type and path, and the errors reported.
+func crawl(t *testing.T, base string, opts Options) ([]string, []error) {
+	t.Helper()
+	c := NewCrawlerWithOptions(opts)
+	var errs []error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for err := range c.Errors() {
+			errs = append(errs, err)
+		}
+	}()
+	go c.Crawl(base)
+	var paths []string
+	for p := range c.Paths() {
+		paths = append(paths, fmt.Sprintf("%s %s", p.Type, p.Path))
+	}
+	wg.Wait()
+	return paths, errs
+}
+
+func TestCrawlOrder(t *testing.T) {
+	mem := newTree()
+	paths, errs := crawl(t, "/home/user/src", Options{FS: mem})
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	// Each directory is sent once read, followed by its files; the
+	// directories nearest the base come first, up to the root
+	want := []string{
+		"dir /home/user/src",
+		"file /home/user/src/go.mod",
+		"symlink /home/user/src/latest",
+		"dir /home/user/src/a",
+		"file /home/user/src/a/x.go",
+		"dir /home/user/src/b",
+		"dir /home/user",
+		"dir /home/user/docs",
+		"file /home/user/docs/readme.md",
+		"dir /home",
+		"dir /",
+		"dir /etc",
+		"file /etc/hosts",
+	}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got  %q\nwant %q", paths, want)
+	}
+}
+
+func TestCrawlOptions(t *testing.T) {
+	mem := newTree()
+	paths, _ := crawl(t, "/home/user/src", Options{
+		FS:    mem,
+		Types: []entry.FileType{entry.FileTypeDir},
+		// Ignored directories are not crawled either
+		Ignore: []string{"docs"},
+	})
+	want := []string{
+		"dir /home/user/src",
+		"dir /home/user/src/a",
+		"dir /home/user/src/b",
+		"dir /home/user",
+		"dir /home",
+		"dir /",
+		"dir /etc",
+	}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got  %q\nwant %q", paths, want)
+	}
+}
+
+func TestCrawlAbove(t *testing.T) {
+	mem := newTree()
+	c := NewCrawlerWithOptions(Options{FS: mem})
+	go c.CrawlAbove("/home/user/src")
+	var paths []string
+	for p := range c.Paths() {
+		paths = append(paths, p.Path)
+	}
+	// What TestCrawlOrder finds, but for the directory left out
+	want := []string{"/home/user", "/home/user/docs", "/home/user/docs/readme.md", "/home", "/", "/etc", "/etc/hosts"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got  %q\nwant %q", paths, want)
+	}
+}
+
+func TestCrawlStats(t *testing.T) {
+	const delay = 10 * time.Millisecond
+	slow := &vfs.Faulty{FS: newTree(), Fault: func(op string, name string) error {
+		if op == vfs.OpReadDir {
+			time.Sleep(delay)
+		}
+		return nil
+	}}
+	c := NewCrawlerWithOptions(Options{FS: slow})
+	go func() {
+		for range c.Errors() {
+		}
+	}()
+	go c.Crawl("/home/user/src")
+	var n int64
+	for range c.Paths() {
+		n++
+	}
+	s := c.Stats()
+	if !s.Done {
+		t.Errorf("expected the crawl to be done once its paths were read")
+	}
+	if s.Dirs+s.Files != n {
+		t.Errorf("expected %d entries counted, got %d dirs and %d files", n, s.Dirs, s.Files)
+	}
+	if s.Elapsed < delay {
+		t.Errorf("expected the crawl to take at least %v, got %v", delay, s.Elapsed)
+	}
+}
+
+func TestCrawlProjectsAndModTimes(t *testing.T) {
+	mem := newTree()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mem.Chtimes("/home/user/src", modTime)
+	c := NewCrawlerWithOptions(Options{IgnoreErrors: true, FS: mem, Markers: project.DefaultMarkers})
+	go c.Crawl("/home/user/src")
+	found := make(map[string]Path)
+	for p := range c.Paths() {
+		found[p.Path] = p
+	}
+	if p := found["/home/user/src"]; p.Project != "go" || !p.ModTime.Equal(modTime) {
+		t.Errorf("unexpected base %+v", p)
+	}
+	if p := found["/home/user/src/a"]; p.Project != "" {
+		t.Errorf("unexpected project %q", p.Project)
+	}
+	if s := c.Stats(); !s.Done || s.Dirs != 8 || s.Files != 5 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCrawlErrors(t *testing.T) {
+	mem := newTree()
+	faulty := &vfs.Faulty{FS: mem, Fault: func(op string, name string) error {
+		switch {
+		case op == vfs.OpOpen && name == "/home/user/docs":
+			return fs.ErrPermission
+		case op == vfs.OpReadDir && name == "/etc":
+			return syscall.EIO
+		}
+		return nil
+	}}
+	c := NewCrawlerWithOptions(Options{FS: faulty})
+	var errs []error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range c.Errors() {
+			errs = append(errs, err)
+		}
+	}()
+	go c.Crawl("/home/user/src")
+	var paths []string
+	for p := range c.Paths() {
+		paths = append(paths, p.Path)
+	}
+	<-done
+
+	// Directories that could not be read are still sent, without their
+	// entries, and the crawl goes on
+	for _, path := range []string{"/home/user/docs", "/etc", "/home/user/src/b"} {
+		if !slices.Contains(paths, path) {
+			t.Errorf("expected %s to be sent", path)
+		}
+	}
+	for _, path := range []string{"/home/user/docs/readme.md", "/etc/hosts"} {
+		if slices.Contains(paths, path) {
+			t.Errorf("expected %s not to be sent", path)
+		}
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs)
+	}
+	var pathErr *fs.PathError
+	if !errors.As(errs[0], &pathErr) || pathErr.Path != "/home/user/docs" || !errors.Is(errs[0], fs.ErrPermission) {
+		t.Errorf("unexpected first error %v", errs[0])
+	}
+	if !errors.As(errs[1], &pathErr) || pathErr.Path != "/etc" || !errors.Is(errs[1], syscall.EIO) {
+		t.Errorf("unexpected second error %v", errs[1])
+	}
+	if s := c.Stats(); s.PermissionDenied != 1 || s.Errors != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCrawlStop(t *testing.T) {
+	mem := newTree()
+	reached := make(chan struct{})
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var opened []string
+	faulty := &vfs.Faulty{FS: mem, Fault: func(op string, name string) error {
+		if op != vfs.OpOpen {
+			return nil
+		}
+		mu.Lock()
+		opened = append(opened, name)
+		mu.Unlock()
+		// A slow directory, stopped while it is read
+		if name == "/home/user/src/b" {
+			close(reached)
+			<-release
+		}
+		return nil
+	}}
+	c := NewCrawlerWithOptions(Options{IgnoreErrors: true, FS: faulty})
+	go c.Crawl("/home/user/src")
+	<-reached
+	c.Stop()
+	close(release)
+
+	timeout := time.After(5 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-c.Paths():
+		case <-timeout:
+			t.Fatal("the crawl did not end once stopped")
+		}
+	}
+	// Nothing is read once the directory being read is done
+	want := []string{"/home/user/src", "/home/user/src/a", "/home/user/src/b"}
+	if !slices.Equal(opened, want) {
+		t.Errorf("opened %q, want %q", opened, want)
+	}
+	if _, ok := <-c.Done(); ok {
+		t.Error("expected Done to be closed")
+	}
+}
+
+func TestCrawlStopUnread(t *testing.T) {
+	// More entries than the channel holds, which nobody reads
+	mem := vfs.NewMem()
+	for i := range 5000 {
+		mem.WriteFile(fmt.Sprintf("/big/file%04d", i), nil)
+	}
+	c := NewCrawlerWithOptions(Options{IgnoreErrors: true, FS: mem})
+	finished := make(chan struct{})
+	go func() {
+		c.Crawl("/big")
+		close(finished)
+	}()
+	for c.Stats().Files < int64(cap(c.pathChan)) {
+		time.Sleep(time.Millisecond)
+	}
+	c.Stop()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the crawl did not end once stopped")
+	}
+	if s := c.Stats(); s.Files >= 5000 {
+		t.Errorf("expected the crawl to stop early, got %+v", s)
+	}
+}
+
+func TestCrawlArchives(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"app/go.mod", "app/logs/today.log"} {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	mem := vfs.NewMem()
+	mem.WriteFile("/data/bundle.zip", buf.Bytes())
+	mem.WriteFile("/data/notes.txt", nil)
+
+	paths, errs := crawl(t, "/data", Options{FS: mem, Archives: true})
+	if len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	// Archives are read in their turn, as directories
+	want := []string{
+		"dir /data",
+		"file /data/bundle.zip",
+		"file /data/notes.txt",
+		"dir /data/bundle.zip!",
+		"dir /data/bundle.zip!/app",
+		"file /data/bundle.zip!/app/go.mod",
+		"dir /data/bundle.zip!/app/logs",
+		"file /data/bundle.zip!/app/logs/today.log",
+		"dir /",
+	}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got  %q\nwant %q", paths, want)
+	}
+}
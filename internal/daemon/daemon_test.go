@@ -0,0 +1,298 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+)
+
+// startDaemon indexes root and serves it on a socket until the test ends.
+func startDaemon(t *testing.T, root string, ignore ...string) *Client {
+	t.Helper()
+	index := NewIndex(ignore, func(err error) { t.Log(err) })
+	if err := index.AddRoot(root); err != nil {
+		t.Fatal(err)
+	}
+	go index.Run()
+	return serve(t, index)
+}
+
+// serve serves index on a socket until the test ends.
+func serve(t *testing.T, index *Index) *Client {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- NewServer(index).Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+		index.Close()
+	})
+	return NewClient(socket)
+}
+
+// mkTree creates the directories under root, and the files: the paths
+// whose name has an extension.
+func mkTree(t *testing.T, root string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		path := filepath.Join(root, p)
+		if filepath.Ext(p) != "" {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// crawl returns the paths the daemon sends for base, relative to root.
+func crawl(t *testing.T, c *Client, root, base string, opts crawler.Options) []string {
+	t.Helper()
+	var paths []string
+	stopped, err := c.Crawl(context.Background(), base, opts, func(p crawler.Path) bool {
+		rel, _ := filepath.Rel(root, p.Path)
+		paths = append(paths, rel)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped != root {
+		t.Errorf("expected the crawl to stop at %s, got %q", root, stopped)
+	}
+	return paths
+}
+
+func TestCrawlOrder(t *testing.T) {
+	root := t.TempDir()
+	mkTree(t, root, "a/deep/x.txt", "a/b.txt", "c", "node_modules/pkg")
+	c := startDaemon(t, root)
+
+	// Breadth first from the base, children before the parent, up to the
+	// root but not beyond
+	got := crawl(t, c, root, filepath.Join(root, "a"), crawler.Options{Ignore: []string{"node_modules"}})
+	want := []string{"a", "a/b.txt", "a/deep", "a/deep/x.txt", ".", "c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	got = crawl(t, c, root, root, crawler.Options{Types: []entry.FileType{entry.FileTypeFile}})
+	want = []string{"a/b.txt", "a/deep/x.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files only: got %q, want %q", got, want)
+	}
+}
+
+func TestCrawlProjectsAndModTime(t *testing.T) {
+	root := t.TempDir()
+	mkTree(t, root, "svc/go.mod")
+	c := startDaemon(t, root)
+
+	found := map[string]crawler.Path{}
+	opts := crawler.Options{Markers: project.DefaultMarkers, Types: []entry.FileType{entry.FileTypeDir}}
+	_, err := c.Crawl(context.Background(), root, opts, func(p crawler.Path) bool {
+		found[p.Path] = p
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := found[filepath.Join(root, "svc")]
+	if svc.Project != "go" {
+		t.Errorf("expected svc to be a go project, got %+v", svc)
+	}
+	fi, _ := os.Stat(filepath.Join(root, "svc"))
+	if !svc.ModTime.Equal(fi.ModTime()) {
+		t.Errorf("ModTime = %v, want %v", svc.ModTime, fi.ModTime())
+	}
+}
+
+// eventually retries check until it passes or the test times out.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLiveUpdates(t *testing.T) {
+	root := t.TempDir()
+	mkTree(t, root, "src", "skip")
+	c := startDaemon(t, root, "*.o")
+	has := func(rel string) bool {
+		for _, p := range crawl(t, c, root, root, crawler.Options{}) {
+			if p == rel {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Created at once, before the new directories could be watched
+	mkTree(t, root, "build/out/bin", "build/main.o")
+	eventually(t, "build/out/bin", func() bool { return has("build/out/bin") })
+	if has("build/main.o") {
+		t.Error("ignored file was indexed")
+	}
+
+	if err := os.Rename(filepath.Join(root, "build"), filepath.Join(root, "dist")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the rename", func() bool { return has("dist/out/bin") && !has("build") })
+
+	// Still watched under its new name
+	mkTree(t, root, "dist/out/lib")
+	eventually(t, "dist/out/lib", func() bool { return has("dist/out/lib") })
+
+	if err := os.RemoveAll(filepath.Join(root, "dist")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the removal", func() bool { return !has("dist") && !has("dist/out/lib") })
+
+	s, err := c.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Dirs != 3 || s.Files != 0 || !reflect.DeepEqual(s.Roots, []string{root}) {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCrawlNotIndexed(t *testing.T) {
+	c := startDaemon(t, t.TempDir())
+	called := false
+	_, err := c.Crawl(context.Background(), t.TempDir(), crawler.Options{}, func(crawler.Path) bool {
+		called = true
+		return true
+	})
+	if err == nil || !strings.Contains(err.Error(), ErrNotIndexed.Error()) || called {
+		t.Errorf("expected a not indexed error before any entry, got %v", err)
+	}
+}
+
+func TestCrawlWhileScanning(t *testing.T) {
+	root := t.TempDir()
+	index := NewIndex(nil, func(err error) { t.Log(err) })
+	if err := index.AddRoot(root); err != nil {
+		t.Fatal(err)
+	}
+	// As if the root's first scan was still running
+	index.mu.Lock()
+	index.scanning[root] = true
+	index.mu.Unlock()
+	c := serve(t, index)
+
+	_, err := c.Crawl(context.Background(), root, crawler.Options{}, func(crawler.Path) bool { return true })
+	if err == nil || !strings.Contains(err.Error(), ErrNotIndexed.Error()) {
+		t.Errorf("expected a not indexed error while scanning, got %v", err)
+	}
+	s, err := c.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.Scanning, []string{root}) {
+		t.Errorf("expected %s to be reported as scanning, got %q", root, s.Scanning)
+	}
+}
+
+func TestUnanswered(t *testing.T) {
+	// A daemon that accepts but never answers, as one busy indexing would
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = NewClient(socket).Crawl(context.Background(), "/", crawler.Options{}, func(crawler.Path) bool { return true })
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected %v, got %v", ErrUnavailable, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*replyTimeout {
+		t.Errorf("expected to give up after %v, waited %v", replyTimeout, elapsed)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	c := NewClient(filepath.Join(t.TempDir(), "daemon.sock"))
+	_, err := c.Crawl(context.Background(), "/", crawler.Options{}, func(crawler.Path) bool { return true })
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected %v, got %v", ErrUnavailable, err)
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	c := startDaemon(t, t.TempDir())
+	conn, err := net.Dial("unix", c.Socket())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	json.NewEncoder(conn).Encode(Request{Version: Version + 1, Op: OpStats})
+	var m Message
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != Version || !strings.Contains(m.Error, "unsupported protocol version") {
+		t.Errorf("unexpected answer %+v", m)
+	}
+}
+
+func TestListenRefusesRunningDaemon(t *testing.T) {
+	c := startDaemon(t, t.TempDir())
+	if _, err := Listen(c.Socket()); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected %v, got %v", ErrRunning, err)
+	}
+
+	// A socket left behind by a daemon that died is replaced
+	stale := filepath.Join(t.TempDir(), "daemon.sock")
+	ln, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	ln, err = Listen(stale)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,519 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/watch"
+)
+
+// ErrNotIndexed is returned for a base directory outside every root.
+var ErrNotIndexed = errors.New("not indexed")
+
+// node is an indexed entry. Nodes only know their name: paths are
+// rebuilt from the root down, so renaming a directory is a single update.
+type node struct {
+	name    string
+	typ     entry.FileType
+	modTime time.Time
+	parent  *node
+	// children of a directory, by name; nil for other types
+	children map[string]*node
+}
+
+// Index is an in-memory tree of the entries under a set of roots, kept up
+// to date with inotify while Run runs.
+type Index struct {
+	ignore  []string
+	watcher *watch.Watcher
+	// warn reports the problems that don't stop indexing
+	warn func(error)
+
+	mu    sync.RWMutex
+	roots map[string]*node
+	// scanning holds the roots whose first scan is still running, which
+	// are not crawled until it is done
+	scanning map[string]bool
+	dirs     int64
+	files    int64
+	// full is set once the inotify watches ran out
+	full bool
+}
+
+// NewIndex returns an empty Index skipping the entries whose name matches
+// one of the ignore patterns, and reporting problems to warn. Without
+// inotify, the index is only as fresh as the last scan.
+func NewIndex(ignore []string, warn func(error)) *Index {
+	ix := &Index{ignore: ignore, warn: warn, roots: make(map[string]*node), scanning: make(map[string]bool)}
+	w, err := watch.New()
+	if err != nil {
+		warn(err)
+	} else {
+		ix.watcher = w
+	}
+	return ix
+}
+
+// Close stops watching for changes.
+func (ix *Index) Close() error {
+	if ix.watcher == nil {
+		return nil
+	}
+	return ix.watcher.Close()
+}
+
+// AddRoot indexes dir and everything under it. A root inside another
+// root is already indexed.
+func (ix *Index) AddRoot(dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "index", Path: dir, Err: errors.New("not a directory")}
+	}
+	ix.mu.Lock()
+	if root, _ := ix.rootOf(dir); root != "" {
+		ix.mu.Unlock()
+		return nil
+	}
+	// Roots under the new one are indexed again as part of it
+	for root := range ix.roots {
+		if isUnder(root, dir) {
+			ix.dropRoot(root)
+		}
+	}
+	n := &node{name: dir, typ: entry.FileTypeDir, modTime: fi.ModTime(), children: make(map[string]*node)}
+	ix.roots[dir] = n
+	ix.scanning[dir] = true
+	ix.dirs++
+	ix.mu.Unlock()
+
+	ix.scan(n, dir)
+	ix.mu.Lock()
+	delete(ix.scanning, dir)
+	ix.mu.Unlock()
+	return nil
+}
+
+// Roots returns the indexed roots, sorted.
+func (ix *Index) Roots() []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	roots := make([]string, 0, len(ix.roots))
+	for root := range ix.roots {
+		roots = append(roots, root)
+	}
+	slices.Sort(roots)
+	return roots
+}
+
+// Stats returns the index's size.
+func (ix *Index) Stats() Stats {
+	s := Stats{Roots: ix.Roots()}
+	ix.mu.RLock()
+	s.Dirs, s.Files = ix.dirs, ix.files
+	for root := range ix.scanning {
+		s.Scanning = append(s.Scanning, root)
+	}
+	ix.mu.RUnlock()
+	slices.Sort(s.Scanning)
+	if ix.watcher != nil {
+		s.Watches = ix.watcher.Len()
+	}
+	return s
+}
+
+// Run applies the changes inotify reports to the index, until the index
+// is closed.
+func (ix *Index) Run() {
+	if ix.watcher == nil {
+		return
+	}
+	for e := range ix.watcher.Events() {
+		ix.apply(e)
+	}
+}
+
+// scan reads dir, the path of n, and the directories under it, breadth
+// first, watching each one before reading it so nothing created in between
+// is missed.
+func (ix *Index) scan(n *node, dir string) {
+	type queued struct {
+		n    *node
+		path string
+	}
+	queue := []queued{{n, dir}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		ix.watch(current.path)
+		children, modTime, err := readDir(current.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			ix.warn(err)
+		}
+
+		ix.mu.Lock()
+		if !modTime.IsZero() {
+			current.n.modTime = modTime
+		}
+		for _, child := range children {
+			if ix.ignored(child.Name()) {
+				continue
+			}
+			c := ix.link(current.n, child.Name(), typeOf(child.Type()))
+			if c.typ == entry.FileTypeDir {
+				queue = append(queue, queued{c, filepath.Join(current.path, child.Name())})
+			}
+		}
+		ix.mu.Unlock()
+	}
+}
+
+// watch starts watching dir, warning once when the watches run out.
+func (ix *Index) watch(dir string) {
+	if ix.watcher == nil {
+		return
+	}
+	err := ix.watcher.Add(dir)
+	if errors.Is(err, watch.ErrNoSpace) {
+		ix.mu.Lock()
+		full := ix.full
+		ix.full = true
+		ix.mu.Unlock()
+		if full {
+			return
+		}
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		ix.warn(err)
+	}
+}
+
+// link adds a child called name to the directory n, unless it has one
+// already, and returns it. The caller holds ix.mu.
+func (ix *Index) link(n *node, name string, typ entry.FileType) *node {
+	if c, ok := n.children[name]; ok && c.typ == typ {
+		return c
+	} else if ok {
+		ix.unlink(c)
+	}
+	c := &node{name: name, typ: typ, parent: n}
+	if typ == entry.FileTypeDir {
+		c.children = make(map[string]*node)
+		ix.dirs++
+	} else {
+		ix.files++
+	}
+	n.children[name] = c
+	return c
+}
+
+// unlink removes n and everything under it from the tree. The caller
+// holds ix.mu.
+func (ix *Index) unlink(n *node) {
+	if n.parent != nil && n.parent.children[n.name] == n {
+		delete(n.parent.children, n.name)
+	}
+	dirs, files := count(n)
+	ix.dirs -= dirs
+	ix.files -= files
+}
+
+func count(n *node) (dirs, files int64) {
+	if n.children == nil {
+		return 0, 1
+	}
+	dirs = 1
+	for _, c := range n.children {
+		d, f := count(c)
+		dirs += d
+		files += f
+	}
+	return dirs, files
+}
+
+// apply updates the index with a change reported by inotify.
+func (ix *Index) apply(e watch.Event) {
+	switch e.Op {
+	case watch.Create:
+		ix.create(e.Path)
+	case watch.Remove:
+		ix.remove(e.Path)
+	case watch.Rename:
+		ix.rename(e.OldPath, e.Path)
+	case watch.Overflow:
+		// Events were lost, so only reading everything again is safe
+		for _, root := range ix.Roots() {
+			ix.mu.Lock()
+			ix.dropRoot(root)
+			ix.mu.Unlock()
+			if err := ix.AddRoot(root); err != nil {
+				ix.warn(err)
+			}
+		}
+	}
+}
+
+func (ix *Index) create(path string) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		// Already gone again; its removal follows
+		return
+	}
+	name := filepath.Base(path)
+	if ix.ignored(name) {
+		return
+	}
+	ix.mu.Lock()
+	parent := ix.lookup(filepath.Dir(path))
+	if parent == nil || parent.children == nil {
+		ix.mu.Unlock()
+		return
+	}
+	n := ix.link(parent, name, typeOf(fi.Mode().Type()))
+	ix.mu.Unlock()
+	ix.touch(filepath.Dir(path))
+	if n.typ == entry.FileTypeDir {
+		// The directory may have been filled before it was watched, as
+		// with mkdir -p or a move from elsewhere
+		ix.scan(n, path)
+	}
+}
+
+func (ix *Index) remove(path string) {
+	ix.mu.Lock()
+	n := ix.lookup(path)
+	if n == nil || n.parent == nil {
+		ix.mu.Unlock()
+		return
+	}
+	ix.unlink(n)
+	ix.mu.Unlock()
+	if n.typ == entry.FileTypeDir && ix.watcher != nil {
+		ix.watcher.Remove(path)
+	}
+	ix.touch(filepath.Dir(path))
+}
+
+func (ix *Index) rename(oldPath, newPath string) {
+	ix.mu.Lock()
+	n := ix.lookup(oldPath)
+	parent := ix.lookup(filepath.Dir(newPath))
+	name := filepath.Base(newPath)
+	if n == nil || n.parent == nil || parent == nil || parent.children == nil || ix.ignored(name) {
+		ix.mu.Unlock()
+		// Only one side is indexed: it is a removal or a creation
+		ix.remove(oldPath)
+		ix.create(newPath)
+		return
+	}
+	if old, ok := parent.children[name]; ok && old != n {
+		ix.unlink(old)
+	}
+	delete(n.parent.children, n.name)
+	n.name = name
+	n.parent = parent
+	parent.children[name] = n
+	ix.mu.Unlock()
+	ix.touch(filepath.Dir(oldPath))
+	ix.touch(filepath.Dir(newPath))
+}
+
+// touch refreshes the modification time of the indexed directory dir.
+func (ix *Index) touch(dir string) {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return
+	}
+	ix.mu.Lock()
+	if n := ix.lookup(dir); n != nil {
+		n.modTime = fi.ModTime()
+	}
+	ix.mu.Unlock()
+}
+
+// dropRoot forgets root and stops watching it. The caller holds ix.mu.
+func (ix *Index) dropRoot(root string) {
+	n := ix.roots[root]
+	if n == nil {
+		return
+	}
+	delete(ix.roots, root)
+	ix.unlink(n)
+	if ix.watcher != nil {
+		ix.watcher.Remove(root)
+	}
+}
+
+// rootOf returns the root that path is in, and path relative to it.
+// The caller holds ix.mu.
+func (ix *Index) rootOf(path string) (string, string) {
+	for root := range ix.roots {
+		if path == root {
+			return root, ""
+		}
+		if isUnder(path, root) {
+			return root, strings.TrimPrefix(path[len(root):], "/")
+		}
+	}
+	return "", ""
+}
+
+// lookup returns the node of path, or nil if it is not indexed. The caller
+// holds ix.mu.
+func (ix *Index) lookup(path string) *node {
+	root, rel := ix.rootOf(path)
+	if root == "" {
+		return nil
+	}
+	n := ix.roots[root]
+	if rel == "" {
+		return n
+	}
+	for _, name := range strings.Split(rel, "/") {
+		n = n.children[name]
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func (ix *Index) ignored(name string) bool {
+	return matchesAny(ix.ignore, name)
+}
+
+// Walk calls fn with the entries a crawl of base would find, in the order
+// it would find them, but only within the root base is in: the crawl
+// continues up to the root rather than to /. opts filters the entries as
+// it would the crawl's. Walk stops early when fn returns false.
+func (ix *Index) Walk(base string, opts crawler.Options, fn func(crawler.Path) bool) error {
+	ix.mu.RLock()
+	start := ix.lookup(base)
+	ix.mu.RUnlock()
+	if start == nil || start.children == nil {
+		return &os.PathError{Op: "walk", Path: base, Err: ErrNotIndexed}
+	}
+	markers := project.NewMatcher(opts.Markers)
+	var types map[entry.FileType]bool
+	if len(opts.Types) > 0 {
+		types = make(map[entry.FileType]bool, len(opts.Types))
+		for _, t := range opts.Types {
+			types[t] = true
+		}
+	}
+	emit := func(p crawler.Path) bool {
+		return types != nil && !types[p.Type] || fn(p)
+	}
+
+	type queued struct {
+		n    *node
+		path string
+	}
+	type child struct {
+		name string
+		n    *node
+	}
+	queue := []queued{{start, base}}
+	visited := map[*node]bool{start: true}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		// Copy what is needed of the directory, so that the index is only
+		// locked while reading it, not while fn runs
+		ix.mu.RLock()
+		modTime := current.n.modTime
+		parent := current.n.parent
+		children := make([]child, 0, len(current.n.children))
+		for name, n := range current.n.children {
+			children = append(children, child{name, n})
+		}
+		ix.mu.RUnlock()
+		slices.SortFunc(children, func(a, b child) int {
+			return strings.Compare(a.name, b.name)
+		})
+
+		p := crawler.Path{Path: current.path, Type: entry.FileTypeDir, ModTime: modTime}
+		if markers != nil {
+			names := make([]string, len(children))
+			for i, c := range children {
+				names[i] = c.name
+			}
+			p.Project = markers.Kind(names)
+		}
+		if !emit(p) {
+			return nil
+		}
+		for _, c := range children {
+			if matchesAny(opts.Ignore, c.name) {
+				continue
+			}
+			path := filepath.Join(current.path, c.name)
+			if c.n.children != nil {
+				if !visited[c.n] {
+					visited[c.n] = true
+					queue = append(queue, queued{c.n, path})
+				}
+			} else if !emit(crawler.Path{Path: path, Type: c.n.typ}) {
+				return nil
+			}
+		}
+		if parent != nil && !visited[parent] {
+			visited[parent] = true
+			queue = append(queue, queued{parent, filepath.Dir(current.path)})
+		}
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnder(path, dir string) bool {
+	return strings.HasPrefix(path, dir+"/") || (dir == "/" && path != "/")
+}
+
+func typeOf(mode os.FileMode) entry.FileType {
+	switch {
+	case mode.IsDir():
+		return entry.FileTypeDir
+	case mode&os.ModeSymlink != 0:
+		return entry.FileTypeSymlink
+	}
+	return entry.FileTypeFile
+}
+
+// readDir reads the entries of dir and its modification time.
+func readDir(dir string) ([]os.DirEntry, time.Time, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	var modTime time.Time
+	if fi, err := f.Stat(); err == nil {
+		modTime = fi.ModTime()
+	}
+	children, err := f.ReadDir(-1)
+	return children, modTime, err
+}
@@ -0,0 +1,183 @@
+// Package daemon keeps an index of the entries under a set of roots in
+// memory, up to date with inotify, and serves crawls of it over a Unix
+// socket, so that bcd invocations don't each walk the same trees.
+//
+// The protocol is JSON, one message per line. A client sends a Request
+// and reads Messages until one is Done. The first Message holds the
+// server's Version, and an Error if the request was refused; a server only
+// answers requests of its own version.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+)
+
+// Version is the protocol version spoken by this package.
+const Version = 2
+
+// Operations a Request asks for.
+const (
+	// OpCrawl streams the entries a crawl of Base would find
+	OpCrawl = "crawl"
+	// OpStats returns the size of the index
+	OpStats = "stats"
+)
+
+type Request struct {
+	Version int    `json:"version"`
+	Op      string `json:"op"`
+	// Base is the directory to crawl from, and Types, Markers and Ignore
+	// filter the crawl, as the crawler's Options do
+	Base    string           `json:"base,omitempty"`
+	Types   []entry.FileType `json:"types,omitempty"`
+	Markers []project.Marker `json:"markers,omitempty"`
+	Ignore  []string         `json:"ignore,omitempty"`
+}
+
+// Message is a line of a response.
+type Message struct {
+	Version int    `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	// An entry found by a crawl; ModTime is in Unix nanoseconds
+	Path    string         `json:"path,omitempty"`
+	Type    entry.FileType `json:"type,omitempty"`
+	Project string         `json:"project,omitempty"`
+	ModTime int64          `json:"mtime,omitempty"`
+
+	// Done ends the response; Stats answers OpStats, and Root tells the
+	// root a crawl stopped at, which the client crawls above
+	Done  bool   `json:"done,omitempty"`
+	Stats *Stats `json:"stats,omitempty"`
+	Root  string `json:"root,omitempty"`
+}
+
+// Stats is the size of an index. Scanning lists the roots still being
+// indexed, which the daemon doesn't answer crawls of yet.
+type Stats struct {
+	Roots    []string `json:"roots"`
+	Scanning []string `json:"scanning,omitempty"`
+	Dirs     int64    `json:"dirs"`
+	Files    int64    `json:"files"`
+	Watches  int      `json:"watches"`
+}
+
+// ErrUnavailable is returned when no daemon answers on the socket.
+var ErrUnavailable = errors.New("daemon not running")
+
+// dialTimeout bounds how long a client waits for the daemon to accept,
+// and replyTimeout for its first answer, which is when it falls back to
+// crawling by itself.
+const (
+	dialTimeout  = 200 * time.Millisecond
+	replyTimeout = 500 * time.Millisecond
+)
+
+// Client talks to the daemon listening on a socket.
+type Client struct {
+	socket string
+}
+
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// Socket returns the path of the daemon's socket.
+func (c *Client) Socket() string { return c.socket }
+
+// Crawl calls fn with the entries a crawl of base with opts would find,
+// from the daemon's index, until fn returns false. It returns the root of
+// the index base is in, where the daemon stopped: the entries above it are
+// left to the caller. It fails without calling fn if the daemon is not
+// running, does not speak this protocol version or has not indexed base.
+func (c *Client) Crawl(ctx context.Context, base string, opts crawler.Options, fn func(crawler.Path) bool) (string, error) {
+	req := Request{
+		Op:      OpCrawl,
+		Base:    base,
+		Types:   opts.Types,
+		Markers: opts.Markers,
+		Ignore:  opts.Ignore,
+	}
+	done, err := c.do(ctx, req, func(m Message) bool {
+		var modTime time.Time
+		if m.ModTime != 0 {
+			modTime = time.Unix(0, m.ModTime)
+		}
+		return fn(crawler.Path{Path: m.Path, Type: m.Type, Project: m.Project, ModTime: modTime})
+	})
+	return done.Root, err
+}
+
+// Stats returns the size of the daemon's index.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	done, err := c.do(ctx, Request{Op: OpStats}, func(Message) bool { return true })
+	if err != nil {
+		return Stats{}, err
+	}
+	if done.Stats == nil {
+		return Stats{}, errors.New("daemon sent no stats")
+	}
+	return *done.Stats, nil
+}
+
+// do sends req, calls fn with each message of the response after the
+// first, until fn returns false, and returns the message that ends it.
+func (c *Client) do(ctx context.Context, req Request, fn func(Message) bool) (Message, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+	// Unblock reads and writes when ctx is done
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req.Version = Version
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	var first Message
+	conn.SetReadDeadline(time.Now().Add(replyTimeout))
+	if err := dec.Decode(&first); err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	// The rest streams for as long as the walk takes
+	conn.SetReadDeadline(time.Time{})
+	if first.Error != "" {
+		return Message{}, errors.New(first.Error)
+	}
+	if first.Version != Version {
+		return Message{}, fmt.Errorf("daemon speaks protocol version %d, not %d", first.Version, Version)
+	}
+	for {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			if ctx.Err() != nil {
+				return Message{}, ctx.Err()
+			}
+			return Message{}, fmt.Errorf("reading from daemon: %w", err)
+		}
+		if m.Done {
+			if m.Error != "" {
+				return m, errors.New(m.Error)
+			}
+			return m, nil
+		}
+		if !fn(m) {
+			return m, nil
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sakolb/bcd/internal/crawler"
+)
+
+// DefaultSocket returns where the daemon listens: in $XDG_RUNTIME_DIR, or
+// a directory of the user's in the temporary directory without it.
+func DefaultSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" || !filepath.IsAbs(dir) {
+		return filepath.Join(os.TempDir(), fmt.Sprintf("bcd-%d", os.Getuid()), "daemon.sock")
+	}
+	return filepath.Join(dir, "bcd", "daemon.sock")
+}
+
+// ErrRunning is returned by Listen when another daemon already listens on
+// the socket.
+var ErrRunning = errors.New("daemon already running")
+
+// Listen listens on socket, replacing what a daemon that did not exit
+// cleanly left behind. Its directory is created private to the user.
+func Listen(socket string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", socket, ErrRunning)
+	}
+	if err := os.Remove(socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", socket)
+}
+
+// Server answers requests from an Index.
+type Server struct {
+	index *Index
+}
+
+func NewServer(index *Index) *Server {
+	return &Server{index: index}
+}
+
+// Serve answers the connections accepted on ln until ctx is done, then
+// closes ln and waits for the connections being answered.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { ln.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle answers the request on conn.
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+	w := bufio.NewWriter(conn)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+
+	if req.Version != Version {
+		enc.Encode(Message{Version: Version, Error: fmt.Sprintf("unsupported protocol version %d (the daemon speaks %d)", req.Version, Version)})
+		return
+	}
+	switch req.Op {
+	case OpCrawl:
+		if !filepath.IsAbs(req.Base) {
+			enc.Encode(Message{Version: Version, Error: fmt.Sprintf("base %q is not absolute", req.Base)})
+			return
+		}
+		base := filepath.Clean(req.Base)
+		opts := crawler.Options{Types: req.Types, Markers: req.Markers, Ignore: req.Ignore}
+		// Check the base before accepting, so the client can still crawl
+		// by itself
+		s.index.mu.RLock()
+		indexed := s.index.lookup(base) != nil
+		root, _ := s.index.rootOf(base)
+		scanning := s.index.scanning[root]
+		s.index.mu.RUnlock()
+		if !indexed {
+			enc.Encode(Message{Version: Version, Error: fmt.Sprintf("%s: %v", base, ErrNotIndexed)})
+			return
+		}
+		if scanning {
+			enc.Encode(Message{Version: Version, Error: fmt.Sprintf("%s: %v yet, %s is still being scanned", base, ErrNotIndexed, root)})
+			return
+		}
+		if enc.Encode(Message{Version: Version}) != nil {
+			return
+		}
+		var werr error
+		err := s.index.Walk(base, opts, func(p crawler.Path) bool {
+			m := Message{Path: p.Path, Type: p.Type, Project: p.Project}
+			if !p.ModTime.IsZero() {
+				m.ModTime = p.ModTime.UnixNano()
+			}
+			werr = enc.Encode(m)
+			return werr == nil
+		})
+		if werr != nil {
+			return
+		}
+		done := Message{Done: true, Root: root}
+		if err != nil {
+			done.Error = err.Error()
+		}
+		enc.Encode(done)
+	case OpStats:
+		stats := s.index.Stats()
+		enc.Encode(Message{Version: Version})
+		enc.Encode(Message{Done: true, Stats: &stats})
+	default:
+		enc.Encode(Message{Version: Version, Error: fmt.Sprintf("unknown operation %q", req.Op)})
+	}
+}
@@ -0,0 +1,119 @@
+// Package datafile reads and updates the small state files bcd keeps
+// between runs. Updates hold an exclusive lock on a sidecar lock file and
+// replace the file atomically, so concurrent shells never lose each
+// other's writes or observe a partially written file.
+package datafile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const appName = "bcd"
+
+// DataPath returns the path of name inside $XDG_DATA_HOME/bcd, falling
+// back to ~/.local/share/bcd.
+func DataPath(name string) (string, error) {
+	return xdgPath("XDG_DATA_HOME", filepath.Join(".local", "share"), name)
+}
+
+// ConfigPath returns the path of name inside $XDG_CONFIG_HOME/bcd, falling
+// back to ~/.config/bcd.
+func ConfigPath(name string) (string, error) {
+	return xdgPath("XDG_CONFIG_HOME", ".config", name)
+}
+
+// DataHome returns $XDG_DATA_HOME, falling back to ~/.local/share. It is
+// shared with other applications, e.g. for the trash.
+func DataHome() (string, error) {
+	return xdgBase("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+func xdgPath(envVar string, homeFallback string, name string) (string, error) {
+	base, err := xdgBase(envVar, homeFallback)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, appName, name), nil
+}
+
+func xdgBase(envVar string, homeFallback string) (string, error) {
+	base := os.Getenv(envVar)
+	if base == "" || !filepath.IsAbs(base) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, homeFallback)
+	}
+	return base, nil
+}
+
+// Read returns the contents of path, or nil if it does not exist yet.
+// Because writers replace the file atomically, reads need no lock.
+func Read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Update calls fn with the current contents of path (nil if it does not
+// exist) while holding an exclusive lock, and atomically replaces the
+// file with whatever fn returns. If fn returns an error the file is left
+// untouched.
+func Update(path string, fn func(data []byte) ([]byte, error)) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	data, err := Read(path)
+	if err != nil {
+		return err
+	}
+	data, err = fn(data)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data)
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it
+// into place.
+func writeAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,37 +2,234 @@ package entry
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sakolb/bcd/internal/gitinfo"
+	"github.com/sakolb/bcd/internal/vfs"
 )
 
-type FileType string
+// FileType is the kind of an entry; the zero FileType is unknown.
+type FileType uint8
 
 const (
-	FileTypeFile    FileType = "file"
-	FileTypeDir     FileType = "dir"
-	FileTypeSymlink FileType = "symlink"
+	FileTypeFile FileType = iota + 1
+	FileTypeDir
+	FileTypeSymlink
 )
 
+var fileTypeNames = [...]string{FileTypeFile: "file", FileTypeDir: "dir", FileTypeSymlink: "symlink"}
+
+var ErrInvalidFileType = errors.New("invalid file type")
+
+// String returns the name of t: "file", "dir" or "symlink".
+func (t FileType) String() string {
+	if int(t) < len(fileTypeNames) {
+		return fileTypeNames[t]
+	}
+	return "FileType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// MarshalText encodes t by its name, so types keep their names in JSON.
+func (t FileType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a name written by MarshalText.
+func (t *FileType) UnmarshalText(b []byte) error {
+	for i, name := range fileTypeNames {
+		if name != "" && name == string(b) {
+			*t = FileType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q", ErrInvalidFileType, b)
+}
+
+// ParseFileType parses a file type as accepted by --type: d or dir, f or
+// file, l or symlink.
+func ParseFileType(s string) (FileType, error) {
+	switch s {
+	case "d", "dir", "directory":
+		return FileTypeDir, nil
+	case "f", "file":
+		return FileTypeFile, nil
+	case "l", "symlink", "link":
+		return FileTypeSymlink, nil
+	}
+	return 0, fmt.Errorf("%w %q (expected d, f or l)", ErrInvalidFileType, s)
+}
+
+// ParseFileTypes parses a comma separated list of file types.
+func ParseFileTypes(s string) ([]FileType, error) {
+	var types []FileType
+	for _, part := range strings.Split(s, ",") {
+		t, err := ParseFileType(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
 type PathEntry struct {
-	AbsPath  string
+	// Path is where the entry is; AbsPath materializes it
+	Path     Path
 	Distance int
 	FType    FileType
+	// Origin is the source that produced the entry, e.g. "crawl".
+	Origin Origin
+	// Project is the kind of project a directory is the root of, e.g. "go",
+	// or "" if it is not one or is not known to be.
+	Project string
+	// ModTime is when the entry was last modified; zero when unknown. The
+	// crawl records it for directories, LoadMetadata for any entry.
+	ModTime time.Time
+	// Meta holds the rest of what Lstat reports about the entry; nil
+	// unless loaded with LoadMetadata, to keep entries small.
+	Meta *Metadata
+
+	// git caches the repository metadata read by Git
+	git atomic.Pointer[gitState]
+}
+
+// AbsPath returns the entry's absolute path.
+func (e *PathEntry) AbsPath() string {
+	return e.Path.String()
+}
+
+type gitState struct {
+	info   gitinfo.Info
+	isRepo bool
+}
+
+// Git returns the git metadata of a directory entry, reading it from disk
+// the first time: whether it is a repository root and, if so, its branch
+// and whether it is dirty. It is safe for concurrent use.
+func (e *PathEntry) Git() (gitinfo.Info, bool) {
+	if s := e.git.Load(); s != nil {
+		return s.info, s.isRepo
+	}
+	s := &gitState{}
+	if e.FType == FileTypeDir && gitinfo.IsRepoRoot(e.AbsPath()) {
+		// A repository that cannot be read is still shown as one
+		s.info, _ = gitinfo.Read(e.AbsPath())
+		s.isRepo = true
+	}
+	e.git.Store(s)
+	return s.info, s.isRepo
+}
+
+// CachedGit returns what Git returned, without touching the disk; known is
+// false until Git has been called.
+func (e *PathEntry) CachedGit() (info gitinfo.Info, isRepo bool, known bool) {
+	s := e.git.Load()
+	if s == nil {
+		return gitinfo.Info{}, false, false
+	}
+	return s.info, s.isRepo, true
+}
+
+// Moved returns a copy of the entry at newPath, as after a rename. Lazily
+// read metadata is dropped, to be read again at the new path.
+func (e *PathEntry) Moved(newPath string) *PathEntry {
+	return &PathEntry{
+		Path:     MakePath(newPath),
+		Distance: e.Distance,
+		FType:    e.FType,
+		Origin:   e.Origin,
+		Project:  e.Project,
+		ModTime:  e.ModTime,
+		Meta:     e.Meta,
+	}
+}
+
+// Metadata is what Lstat reports about an entry, beyond its type and
+// modification time.
+type Metadata struct {
+	Size int64
+	Mode fs.FileMode
+	UID  uint32
+	GID  uint32
+}
+
+func NewMetadata(fi fs.FileInfo) *Metadata {
+	m := &Metadata{Size: fi.Size(), Mode: fi.Mode()}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		m.UID = st.Uid
+		m.GID = st.Gid
+	}
+	return m
+}
+
+// LoadMetadata reads the entry's metadata from disk into Meta.
+func (e *PathEntry) LoadMetadata() error {
+	fi, err := os.Lstat(e.AbsPath())
+	if err != nil {
+		return err
+	}
+	e.ModTime = fi.ModTime()
+	e.Meta = NewMetadata(fi)
+	return nil
+}
+
+// owners caches user names by uid, as there are few of them and looking
+// them up reads /etc/passwd.
+var owners sync.Map
+
+// Owner returns the name of the entry's owner, or its uid when it has no
+// name.
+func (m *Metadata) Owner() string {
+	if name, ok := owners.Load(m.UID); ok {
+		return name.(string)
+	}
+	uid := strconv.FormatUint(uint64(m.UID), 10)
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	owners.Store(m.UID, name)
+	return name
 }
 
 var ErrNotAbsolute = errors.New("path is not absolute")
 
 func NewPathEntry(entryAbsPath string, baseDirAbsPath string) (*PathEntry, error) {
+	return NewPathEntryFS(vfs.OS, entryAbsPath, baseDirAbsPath)
+}
+
+// NewPathEntryFS is NewPathEntry, reading the file type from fsys.
+func NewPathEntryFS(fsys vfs.FS, entryAbsPath string, baseDirAbsPath string) (*PathEntry, error) {
 	if !filepath.IsAbs(entryAbsPath) || !filepath.IsAbs(baseDirAbsPath) {
 		return nil, ErrNotAbsolute
 	}
 
-	filetype, err := getFileType(entryAbsPath)
+	filetype, err := getFileType(fsys, entryAbsPath)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewPathEntryWithType(entryAbsPath, baseDirAbsPath, filetype)
+}
+
+// NewPathEntryWithType builds a PathEntry without touching the filesystem,
+// trusting the caller for the file type. It is used for candidates that
+// may not exist on disk, such as paths read from stdin.
+func NewPathEntryWithType(entryAbsPath string, baseDirAbsPath string, filetype FileType) (*PathEntry, error) {
+	if !filepath.IsAbs(entryAbsPath) || !filepath.IsAbs(baseDirAbsPath) {
+		return nil, ErrNotAbsolute
+	}
+
 	pathForDistance := entryAbsPath
 	if filetype == FileTypeFile {
 		pathForDistance = filepath.Dir(pathForDistance)
@@ -51,15 +248,15 @@ func NewPathEntry(entryAbsPath string, baseDirAbsPath string) (*PathEntry, error
 	}
 
 	return &PathEntry{
-		AbsPath:  entryAbsPath,
+		Path:     MakePath(entryAbsPath),
 		Distance: distance,
 		FType:    filetype,
 	}, nil
 }
 
 func DistanceBetween(a, b *PathEntry) (int, error) {
-	pathForDistanceA := a.AbsPath
-	pathForDistanceB := b.AbsPath
+	pathForDistanceA := a.AbsPath()
+	pathForDistanceB := b.AbsPath()
 	if a.FType == FileTypeFile {
 		pathForDistanceA = filepath.Dir(pathForDistanceA)
 	}
@@ -79,12 +276,12 @@ func DistanceBetween(a, b *PathEntry) (int, error) {
 	return distance, nil
 }
 
-func getFileType(entryAbsPath string) (FileType, error) {
-	fileinfo, err := os.Lstat(entryAbsPath)
+func getFileType(fsys vfs.FS, entryAbsPath string) (FileType, error) {
+	fileinfo, err := fsys.Lstat(entryAbsPath)
 	if err != nil {
 		return FileTypeFile, err
 	}
-	if fileinfo.Mode()&os.ModeSymlink != 0 {
+	if fileinfo.Mode()&fs.ModeSymlink != 0 {
 		return FileTypeSymlink, nil
 	}
 	if fileinfo.IsDir() {
@@ -1,9 +1,13 @@
 package entry
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/sakolb/bcd/internal/vfs"
 )
 
 func TestNewPathEntry_ValidAbsolutePath(t *testing.T) {
@@ -17,8 +21,8 @@ func TestNewPathEntry_ValidAbsolutePath(t *testing.T) {
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
-	if entry.AbsPath != tempFile {
-		t.Errorf("expected AbsPath %s, go %s", tempFile, entry.AbsPath)
+	if entry.AbsPath() != tempFile {
+		t.Errorf("expected AbsPath %s, go %s", tempFile, entry.AbsPath())
 	}
 	if entry.FType != FileTypeFile {
 		t.Errorf("expected %s, got %s", FileTypeFile, entry.FType)
@@ -122,8 +126,8 @@ func TestDistanceBetween(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			a := &PathEntry{AbsPath: test.pathA}
-			b := &PathEntry{AbsPath: test.pathB}
+			a := &PathEntry{Path: MakePath(test.pathA)}
+			b := &PathEntry{Path: MakePath(test.pathB)}
 
 			dist, err := DistanceBetween(a, b)
 			if err != nil {
@@ -137,8 +141,163 @@ func TestDistanceBetween(t *testing.T) {
 }
 
 func TestGetFileType_NonexistancePath(t *testing.T) {
-	_, err := getFileType("/nonexistent/path/12345")
+	_, err := getFileType(vfs.OS, "/nonexistent/path/12345")
 	if err == nil {
 		t.Error("expected error for nonexistent path")
 	}
 }
+
+func TestNewPathEntryFS(t *testing.T) {
+	mem := vfs.NewMem()
+	mem.WriteFile("/home/user/notes.txt", nil)
+	mem.Symlink("/home/user/latest")
+	tests := []struct {
+		path     string
+		expected FileType
+	}{
+		{"/home/user", FileTypeDir},
+		{"/home/user/notes.txt", FileTypeFile},
+		{"/home/user/latest", FileTypeSymlink},
+	}
+	for _, test := range tests {
+		entry, err := NewPathEntryFS(mem, test.path, "/home")
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", test.path, err)
+		}
+		if entry.FType != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.path, test.expected, entry.FType)
+		}
+	}
+
+	// Failures of the filesystem are returned as they are
+	faulty := &vfs.Faulty{FS: mem, Fault: func(op string, name string) error {
+		return fs.ErrPermission
+	}}
+	if _, err := NewPathEntryFS(faulty, "/home/user", "/home"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected %v, got %v", fs.ErrPermission, err)
+	}
+	if _, err := NewPathEntryFS(mem, "/home/user/missing", "/home"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestNewPathEntryWithType_NoFilesystemAccess(t *testing.T) {
+	entry, err := NewPathEntryWithType("/nonexistent/base/a/b.txt", "/nonexistent/base", FileTypeFile)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if entry.FType != FileTypeFile {
+		t.Errorf("expected %s, got %s", FileTypeFile, entry.FType)
+	}
+	if entry.Distance != 1 {
+		t.Errorf("expected distance 1, got %d", entry.Distance)
+	}
+
+	_, err = NewPathEntryWithType("relative/path", "/absolute/base", FileTypeDir)
+	if err != ErrNotAbsolute {
+		t.Errorf("expected %v, got %v", ErrNotAbsolute, err)
+	}
+}
+
+func TestParseFileTypes(t *testing.T) {
+	types, err := ParseFileTypes("d, file,l")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []FileType{FileTypeDir, FileTypeFile, FileTypeSymlink}
+	if len(types) != len(want) {
+		t.Fatalf("expected %v, got %v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, types)
+		}
+	}
+
+	if _, err := ParseFileTypes("d,x"); !errors.Is(err, ErrInvalidFileType) {
+		t.Errorf("expected %v, got %v", ErrInvalidFileType, err)
+	}
+}
+
+func TestFileTypeText(t *testing.T) {
+	for _, ft := range []FileType{FileTypeFile, FileTypeDir, FileTypeSymlink} {
+		text, err := ft.MarshalText()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var got FileType
+		if err := got.UnmarshalText(text); err != nil || got != ft {
+			t.Errorf("%s: expected to read back %v, got %v, %v", text, ft, got, err)
+		}
+	}
+
+	var ft FileType
+	if err := ft.UnmarshalText([]byte("d")); !errors.Is(err, ErrInvalidFileType) {
+		t.Errorf("expected %v, got %v", ErrInvalidFileType, err)
+	}
+}
+
+func TestOriginOf(t *testing.T) {
+	crawl, stdin := OriginOf("crawl"), OriginOf("stdin")
+	if crawl == stdin {
+		t.Errorf("expected distinct origins, got %d for both", crawl)
+	}
+	if OriginOf("crawl") != crawl {
+		t.Errorf("expected the same origin for the same name")
+	}
+	if crawl.String() != "crawl" || stdin.String() != "stdin" {
+		t.Errorf("expected crawl and stdin, got %s and %s", crawl, stdin)
+	}
+	if Origin(0).String() != "" {
+		t.Errorf("expected the zero origin to be unnamed, got %q", Origin(0))
+	}
+}
+
+func TestGit(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &PathEntry{Path: MakePath(repo), FType: FileTypeDir}
+	if _, _, known := e.CachedGit(); known {
+		t.Fatal("expected git metadata to be read lazily")
+	}
+	info, isRepo := e.Git()
+	if !isRepo || info.Branch != "main" {
+		t.Errorf("expected repository on main, got %+v, %v", info, isRepo)
+	}
+	if _, isRepo, known := e.CachedGit(); !known || !isRepo {
+		t.Error("expected git metadata to be cached")
+	}
+
+	if _, isRepo := e.Moved(filepath.Join(repo, ".git")).Git(); isRepo {
+		t.Error("expected a moved entry to read its metadata again")
+	}
+}
+
+func TestLoadMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewPathEntry(path, filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Meta != nil {
+		t.Fatal("expected metadata to be opt-in")
+	}
+	if err := e.LoadMetadata(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.Meta.Size != 5 || e.Meta.Mode.Perm() != 0o640 || e.ModTime.IsZero() {
+		t.Errorf("unexpected metadata %+v", e.Meta)
+	}
+	if e.Meta.UID != uint32(os.Getuid()) || e.Meta.Owner() == "" {
+		t.Errorf("expected owner %d, got %d (%q)", os.Getuid(), e.Meta.UID, e.Meta.Owner())
+	}
+}
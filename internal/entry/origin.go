@@ -0,0 +1,45 @@
+package entry
+
+import "sync"
+
+// Origin is the source that produced an entry, e.g. "crawl". There are
+// only a handful of sources, so entries keep a number standing for the
+// name; the zero Origin is the empty name.
+type Origin uint8
+
+// origins holds every source name seen, indexed by its Origin.
+var origins = struct {
+	sync.RWMutex
+	names []string
+	m     map[string]Origin
+}{names: []string{""}, m: map[string]Origin{"": 0}}
+
+// OriginOf returns the Origin of the source called name. It panics if
+// more sources are named than an Origin can tell apart.
+func OriginOf(name string) Origin {
+	origins.RLock()
+	o, ok := origins.m[name]
+	origins.RUnlock()
+	if ok {
+		return o
+	}
+	origins.Lock()
+	defer origins.Unlock()
+	if o, ok := origins.m[name]; ok {
+		return o
+	}
+	if len(origins.names) > 255 {
+		panic("entry: too many origins")
+	}
+	o = Origin(len(origins.names))
+	origins.names = append(origins.names, name)
+	origins.m[name] = o
+	return o
+}
+
+// String returns the name of the source.
+func (o Origin) String() string {
+	origins.RLock()
+	defer origins.RUnlock()
+	return origins.names[o]
+}
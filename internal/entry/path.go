@@ -0,0 +1,190 @@
+package entry
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// dir is an interned directory: its parent, nil for the root, and its
+// name. Every path below a directory shares its dir, so a path costs its
+// last element rather than its full length.
+type dir = *dirNode
+
+type dirNode struct {
+	parent dir
+	name   string
+}
+
+// dirs holds every directory interned. They are never dropped: there are
+// far fewer directories than entries, and they are mostly crawled again.
+var dirs = struct {
+	sync.Mutex
+	m map[dirNode]dir
+}{m: make(map[dirNode]dir)}
+
+// Path is an absolute, clean path, stored as its interned parent
+// directory and its last element. The zero Path is the empty path.
+type Path struct {
+	dir  dir
+	name string
+}
+
+// rootPath is "/", the only path without a parent.
+var rootPath = Path{name: "/"}
+
+// lastDir caches the parent directory of the last path made, as paths
+// usually come in bunches from the same directory.
+var lastDir atomic.Pointer[cachedDir]
+
+type cachedDir struct {
+	path string
+	dir  dir
+}
+
+// MakePath returns the Path of p, cleaned first, or the zero Path if p
+// is not absolute. Only the last element is copied: p is not retained.
+func MakePath(p string) Path {
+	if p == "" || p[0] != '/' {
+		return Path{}
+	}
+	if !isClean(p) {
+		p = filepath.Clean(p)
+	}
+	if p == "/" {
+		return rootPath
+	}
+	i := strings.LastIndexByte(p, '/')
+	parent, name := p[:i], strings.Clone(p[i+1:])
+	if parent == "" {
+		parent = "/"
+	}
+	c := lastDir.Load()
+	if c != nil && c.path == parent {
+		return Path{dir: c.dir, name: name}
+	}
+	h := internDir(parent, c)
+	lastDir.Store(&cachedDir{path: strings.Clone(parent), dir: h})
+	return Path{dir: h, name: name}
+}
+
+// internDir returns the interned directory at path, a clean absolute
+// path. In the order a crawl finds paths, it is usually the child or the
+// parent of the last directory, c, which saves interning every element
+// again.
+func internDir(path string, c *cachedDir) dir {
+	if path == "/" {
+		return rootPath.intern()
+	}
+	i := strings.LastIndexByte(path, '/')
+	if c != nil {
+		if path[:max(i, 1)] == c.path {
+			return Path{dir: c.dir, name: path[i+1:]}.intern()
+		}
+		if j := strings.LastIndexByte(c.path, '/'); c.path[:max(j, 1)] == path {
+			return c.dir.parent
+		}
+	}
+	d := rootPath
+	for _, elem := range strings.Split(path[1:], "/") {
+		d = d.Join(elem)
+	}
+	return d.intern()
+}
+
+// isClean reports cheaply whether p is surely clean, as paths built by
+// the crawl are, so that cleaning can be skipped.
+func isClean(p string) bool {
+	if p[0] != '/' || len(p) > 1 && p[len(p)-1] == '/' {
+		return false
+	}
+	return !strings.Contains(p, "//") && !strings.Contains(p, "/.")
+}
+
+// intern returns the interned directory at p.
+func (p Path) intern() dir {
+	key := dirNode{parent: p.dir, name: p.name}
+	dirs.Lock()
+	defer dirs.Unlock()
+	d, ok := dirs.m[key]
+	if !ok {
+		key.name = strings.Clone(key.name)
+		d = &key
+		dirs.m[key] = d
+	}
+	return d
+}
+
+// Join returns the path of the entry called name in the directory p.
+func (p Path) Join(name string) Path {
+	return Path{dir: p.intern(), name: name}
+}
+
+// JoinEach returns the paths of the entries called names in the directory
+// p, interning p once for all of them.
+func (p Path) JoinEach(names []string) []Path {
+	if len(names) == 0 {
+		return nil
+	}
+	d := p.intern()
+	paths := make([]Path, len(names))
+	for i, name := range names {
+		paths[i] = Path{dir: d, name: name}
+	}
+	return paths
+}
+
+// Dir returns the parent directory of p; that of "/" is "/".
+func (p Path) Dir() Path {
+	if p.dir == nil {
+		return rootPath
+	}
+	return Path{dir: p.dir.parent, name: p.dir.name}
+}
+
+// Base returns the last element of p, "/" for the root.
+func (p Path) Base() string {
+	return p.name
+}
+
+// IsZero reports whether p is the empty path.
+func (p Path) IsZero() bool {
+	return p == Path{}
+}
+
+// String materializes the path.
+func (p Path) String() string {
+	if p.dir == nil {
+		return p.name
+	}
+	return string(p.appendTo(make([]byte, 0, 64)))
+}
+
+// appendTo appends the path to buf.
+func (p Path) appendTo(buf []byte) []byte {
+	if p.dir == nil {
+		return append(buf, p.name...)
+	}
+	// The elements are found from the last one up, so they are written in
+	// place at the end of buf, right to left
+	n := len(p.name)
+	for d := p.dir; d != nil; d = d.parent {
+		if d.parent != nil {
+			n += len(d.name) + 1
+		} else {
+			n++
+		}
+	}
+	buf = append(buf, make([]byte, n)...)
+	end := len(buf)
+	end -= copy(buf[end-len(p.name):], p.name)
+	for d := p.dir; d != nil; d = d.parent {
+		end--
+		buf[end] = '/'
+		if d.parent != nil {
+			end -= copy(buf[end-len(d.name):end], d.name)
+		}
+	}
+	return buf
+}
@@ -0,0 +1,69 @@
+package entry
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMakePath(t *testing.T) {
+	paths := []string{
+		"/", "/a", "/a/b", "/a/b/c.txt", "/a/b/d", "/a/b/d/e", "/a/x", "/a",
+		"/z/y/x/w", "/z/y", "/a/b/d/e/f/g", "/a/b", "/q", "/a/b/c.txt",
+	}
+	// Out of order too, as the cache of the last directory must not
+	// change the result
+	shuffled := append([]string(nil), paths...)
+	rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	made := make(map[string]Path)
+	for _, list := range [][]string{paths, shuffled} {
+		for _, p := range list {
+			got := MakePath(p)
+			if got.String() != p {
+				t.Errorf("MakePath(%q) = %q", p, got)
+			}
+			if prev, ok := made[p]; ok && prev != got {
+				t.Errorf("MakePath(%q) made two different paths", p)
+			}
+			made[p] = got
+		}
+	}
+
+	for _, tt := range []struct{ in, want string }{
+		{"/a//b/./c/", "/a/b/c"},
+		{"/a/b/../.git", "/a/.git"},
+		{"/.", "/"},
+	} {
+		if got := MakePath(tt.in); got != MakePath(tt.want) || got.String() != tt.want {
+			t.Errorf("MakePath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if !MakePath("").IsZero() || MakePath("").String() != "" {
+		t.Error("the empty path is not zero")
+	}
+	for _, p := range []string{"foo", "a/b", ".", "../x"} {
+		if !MakePath(p).IsZero() {
+			t.Errorf("MakePath(%q) = %q, want the zero path for a relative path", p, MakePath(p))
+		}
+	}
+}
+
+func TestPathNavigation(t *testing.T) {
+	p := MakePath("/home/user/src")
+	if p.Base() != "src" || p.Dir() != MakePath("/home/user") || p.Dir().Dir().Dir() != MakePath("/") {
+		t.Errorf("unexpected parents of %q", p)
+	}
+	if root := MakePath("/"); root.Dir() != root || root.Base() != "/" {
+		t.Errorf("unexpected root %q", root)
+	}
+	if got := p.Join("bcd"); got != MakePath("/home/user/src/bcd") || got.String() != "/home/user/src/bcd" {
+		t.Errorf("Join = %q", got)
+	}
+	if got := MakePath("/").Join("etc"); got != MakePath("/etc") {
+		t.Errorf("Join from the root = %q", got)
+	}
+	if got := p.JoinEach([]string{"a", "b"}); len(got) != 2 || got[0] != p.Join("a") || got[1].String() != "/home/user/src/b" {
+		t.Errorf("JoinEach = %q", got)
+	}
+}
@@ -0,0 +1,269 @@
+// Package gitinfo reads the state of a git repository straight from its
+// .git directory, without running git: the current branch from HEAD, and
+// whether tracked files changed by comparing them with the index.
+package gitinfo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Info struct {
+	// Branch is the checked out branch, or the abbreviated commit when
+	// HEAD is detached.
+	Branch   string
+	Detached bool
+	// Dirty is set when a tracked file was modified or deleted since it was
+	// last staged. Untracked files are not considered.
+	Dirty bool
+}
+
+var ErrBadIndex = errors.New("unsupported git index")
+
+// IsRepoRoot reports whether dir is the root of a git work tree, i.e.
+// contains a .git directory, or a .git file as used by worktrees and
+// submodules.
+func IsRepoRoot(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// Read returns the state of the repository rooted at dir.
+func Read(dir string) (Info, error) {
+	gitDir, err := resolveGitDir(dir)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := readHead(gitDir)
+	if err != nil {
+		return Info{}, err
+	}
+	info.Dirty, err = dirty(dir, filepath.Join(gitDir, "index"))
+	return info, err
+}
+
+// resolveGitDir follows a "gitdir:" file to the actual git directory.
+func resolveGitDir(dir string) (string, error) {
+	gitPath := filepath.Join(dir, ".git")
+	fi, err := os.Stat(gitPath)
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return gitPath, nil
+	}
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return "", err
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s: not a gitdir file", gitPath)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return target, nil
+}
+
+func readHead(gitDir string) (Info, error) {
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return Info{}, err
+	}
+	head := strings.TrimSpace(string(data))
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		return Info{Branch: strings.TrimPrefix(ref, "refs/heads/")}, nil
+	}
+	if len(head) > 7 {
+		head = head[:7]
+	}
+	return Info{Branch: head, Detached: true}, nil
+}
+
+// indexEntry is the part of an index entry needed to spot changes.
+type indexEntry struct {
+	path     string
+	mtimeSec uint32
+	mtimeNs  uint32
+	size     uint32
+	mode     uint32
+	hash     [20]byte
+}
+
+// dirty compares every tracked file with its index entry and stops at the
+// first difference. Like git, it trusts matching metadata and otherwise
+// hashes the file's content. That includes files modified in the same
+// second the index was written, which can't be told apart from clean ones
+// by their metadata (git calls them racily clean).
+func dirty(workTree string, indexPath string) (bool, error) {
+	f, err := os.Open(indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// A fresh repository without an index has nothing staged
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	indexInfo, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	indexMtime := indexInfo.ModTime()
+
+	changed := false
+	err = readIndex(bufio.NewReader(f), func(e indexEntry) bool {
+		// Submodules are checked out repositories of their own
+		if e.mode&0o170000 == 0o160000 {
+			return true
+		}
+		fi, err := os.Lstat(filepath.Join(workTree, e.path))
+		if err != nil {
+			changed = true
+			return false
+		}
+		if uint32(fi.Size()) != e.size {
+			changed = true
+			return false
+		}
+		mtime := fi.ModTime()
+		if uint32(mtime.Unix()) == e.mtimeSec &&
+			(e.mtimeNs == 0 || uint32(mtime.Nanosecond()) == e.mtimeNs) &&
+			mtime.Before(indexMtime.Truncate(1e9)) {
+			return true
+		}
+		hash, err := hashFile(filepath.Join(workTree, e.path), fi)
+		if err != nil || hash != e.hash {
+			changed = true
+			return false
+		}
+		return true
+	})
+	return changed, err
+}
+
+// hashFile returns the id git gives the blob holding the file's content,
+// or a symlink's target.
+func hashFile(path string, fi os.FileInfo) ([20]byte, error) {
+	h := sha1.New()
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		fmt.Fprintf(h, "blob %d\x00%s", len(target), target)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return [20]byte{}, err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "blob %d\x00", fi.Size())
+		if _, err := io.Copy(h, f); err != nil {
+			return [20]byte{}, err
+		}
+	}
+	var sum [20]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// readIndex calls fn for each entry of a version 2, 3 or 4 index until fn
+// returns false.
+func readIndex(r *bufio.Reader, fn func(indexEntry) bool) error {
+	var header struct {
+		Signature [4]byte
+		Version   uint32
+		Count     uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	if string(header.Signature[:]) != "DIRC" || header.Version < 2 || header.Version > 4 {
+		return ErrBadIndex
+	}
+
+	var fixed struct {
+		Ctime, CtimeNs, Mtime, MtimeNs uint32
+		Dev, Ino, Mode, UID, GID, Size uint32
+		Hash                           [20]byte
+		Flags                          uint16
+	}
+	const fixedSize = 62
+	previous := ""
+	for i := uint32(0); i < header.Count; i++ {
+		if err := binary.Read(r, binary.BigEndian, &fixed); err != nil {
+			return err
+		}
+		read := fixedSize
+		if header.Version >= 3 && fixed.Flags&0x4000 != 0 {
+			if _, err := r.Discard(2); err != nil {
+				return err
+			}
+			read += 2
+		}
+
+		var path string
+		if header.Version == 4 {
+			// The path drops some bytes from the end of the previous one
+			// and appends a NUL terminated suffix; there is no padding
+			strip, err := readOffset(r)
+			if err != nil {
+				return err
+			}
+			if strip > uint64(len(previous)) {
+				return ErrBadIndex
+			}
+			suffix, err := r.ReadString(0)
+			if err != nil {
+				return err
+			}
+			path = previous[:len(previous)-int(strip)] + strings.TrimSuffix(suffix, "\x00")
+		} else {
+			name, err := r.ReadBytes(0)
+			if err != nil {
+				return err
+			}
+			read += len(name)
+			path = string(bytes.TrimSuffix(name, []byte{0}))
+			// Entries are padded with NULs to a multiple of eight bytes
+			if pad := (8 - read%8) % 8; pad > 0 {
+				if _, err := r.Discard(pad); err != nil {
+					return err
+				}
+			}
+		}
+		previous = path
+
+		if !fn(indexEntry{path: path, mtimeSec: fixed.Mtime, mtimeNs: fixed.MtimeNs, size: fixed.Size, mode: fixed.Mode, hash: fixed.Hash}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readOffset reads the variable length integer git uses in version 4
+// indexes, where each continuation byte also adds one.
+func readOffset(r io.ByteReader) (uint64, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	value := uint64(c & 0x7f)
+	for c&0x80 != 0 {
+		if c, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		value = ((value + 1) << 7) | uint64(c&0x7f)
+	}
+	return value, nil
+}
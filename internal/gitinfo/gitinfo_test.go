@@ -0,0 +1,172 @@
+package gitinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeIndex writes a version 2 index tracking files as they are now.
+func writeIndex(t *testing.T, repo string, files ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("DIRC")
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(len(files)))
+	for _, name := range files {
+		fi, err := os.Lstat(filepath.Join(repo, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := buf.Len()
+		mtime := fi.ModTime()
+		for _, v := range []uint32{
+			uint32(mtime.Unix()), uint32(mtime.Nanosecond()),
+			uint32(mtime.Unix()), uint32(mtime.Nanosecond()),
+			0, 0, 0o100644, 0, 0, uint32(fi.Size()),
+		} {
+			binary.Write(&buf, binary.BigEndian, v)
+		}
+		hash, err := hashFile(filepath.Join(repo, name), fi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(hash[:])
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		buf.WriteString(name)
+		buf.WriteByte(0)
+		for (buf.Len()-start)%8 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	index := filepath.Join(repo, ".git", "index")
+	if err := os.WriteFile(index, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Written after the files, so they are not racily clean
+	later := time.Now().Add(2 * time.Second)
+	if err := os.Chtimes(index, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newRepo(t *testing.T, head string) string {
+	t.Helper()
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte(head), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"main.go", "a-rather-long-file-name.txt"} {
+		path := filepath.Join(repo, name)
+		if err := os.WriteFile(path, []byte("package main\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeIndex(t, repo, "a-rather-long-file-name.txt", "main.go")
+	return repo
+}
+
+func TestReadClean(t *testing.T) {
+	repo := newRepo(t, "ref: refs/heads/feature/x\n")
+	info, err := Read(repo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Branch != "feature/x" || info.Detached || info.Dirty {
+		t.Errorf("expected clean feature/x, got %+v", info)
+	}
+}
+
+func TestReadDirty(t *testing.T) {
+	repo := newRepo(t, "ref: refs/heads/main\n")
+	if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := Read(repo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !info.Dirty {
+		t.Errorf("expected dirty, got %+v", info)
+	}
+
+	repo = newRepo(t, "ref: refs/heads/main\n")
+	if err := os.Remove(filepath.Join(repo, "main.go")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := Read(repo); !info.Dirty {
+		t.Errorf("expected a deleted file to make the repo dirty, got %+v", info)
+	}
+}
+
+func TestReadTouched(t *testing.T) {
+	repo := newRepo(t, "ref: refs/heads/main\n")
+	path := filepath.Join(repo, "main.go")
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := Read(repo); info.Dirty {
+		t.Errorf("expected a touched file with the same content to be clean, got %+v", info)
+	}
+
+	// Same size, different content
+	if err := os.WriteFile(path, []byte("package mian\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := Read(repo); !info.Dirty {
+		t.Errorf("expected changed content to make the repo dirty, got %+v", info)
+	}
+}
+
+func TestReadDetachedWorktree(t *testing.T) {
+	gitDir := filepath.Join(t.TempDir(), "worktree-git")
+	if err := os.MkdirAll(gitDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("0123456789abcdef0123456789abcdef01234567\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	work := t.TempDir()
+	if err := os.WriteFile(filepath.Join(work, ".git"), []byte("gitdir: "+gitDir+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsRepoRoot(work) {
+		t.Fatal("expected a .git file to mark a repository root")
+	}
+	info, err := Read(work)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Branch != "0123456" || !info.Detached || info.Dirty {
+		t.Errorf("expected clean detached 0123456, got %+v", info)
+	}
+}
+
+func TestReadOffset(t *testing.T) {
+	// Examples from git's varint.c: 0x80 0x00 encodes 128
+	for _, tt := range []struct {
+		in   []byte
+		want uint64
+	}{
+		{[]byte{0x05}, 5},
+		{[]byte{0x80, 0x00}, 128},
+		{[]byte{0x81, 0x7f}, 383},
+	} {
+		got, err := readOffset(bytes.NewReader(tt.in))
+		if err != nil || got != tt.want {
+			t.Errorf("readOffset(%x) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
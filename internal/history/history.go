@@ -0,0 +1,133 @@
+// Package history keeps the frecency history of visited directories,
+// recorded by the shell integration's cd hook. Ranking follows z: each
+// visit adds one to a directory's rank, ranks are weighted by how recently
+// the directory was visited, and old entries age out once the total rank
+// grows too large.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sakolb/bcd/internal/datafile"
+)
+
+const (
+	// maxTotalRank is the total rank above which all ranks are aged.
+	maxTotalRank = 10000
+	// agingFactor scales every rank when the history is aged.
+	agingFactor = 0.9
+	// minRank is the rank below which aged entries are forgotten.
+	minRank = 1
+)
+
+type Entry struct {
+	Path       string    `json:"path"`
+	Rank       float64   `json:"rank"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// DefaultPath returns the history file location.
+func DefaultPath() (string, error) {
+	return datafile.DataPath("history.json")
+}
+
+// Frecency returns the entry's rank weighted by the age of its last visit.
+func (e Entry) Frecency(now time.Time) float64 {
+	age := now.Sub(e.LastAccess)
+	switch {
+	case age < time.Hour:
+		return e.Rank * 4
+	case age < 24*time.Hour:
+		return e.Rank * 2
+	case age < 7*24*time.Hour:
+		return e.Rank / 2
+	default:
+		return e.Rank / 4
+	}
+}
+
+// Load returns the entries stored in file, most frecent first.
+func Load(file string) ([]Entry, error) {
+	data, err := datafile.Read(file)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Frecency(now) > entries[j].Frecency(now)
+	})
+	return entries, nil
+}
+
+// Add records a visit to dir, an absolute path, at time now.
+func Add(file string, dir string, now time.Time) error {
+	if !filepath.IsAbs(dir) {
+		return fmt.Errorf("%s: not an absolute path", dir)
+	}
+	dir = filepath.Clean(dir)
+	return datafile.Update(file, func(data []byte) ([]byte, error) {
+		entries, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		found := false
+		total := 0.0
+		for i := range entries {
+			if entries[i].Path == dir {
+				entries[i].Rank++
+				entries[i].LastAccess = now
+				found = true
+			}
+			total += entries[i].Rank
+		}
+		if !found {
+			entries = append(entries, Entry{Path: dir, Rank: 1, LastAccess: now})
+			total++
+		}
+		if total > maxTotalRank {
+			entries = age(entries)
+		}
+
+		return json.MarshalIndent(entries, "", "  ")
+	})
+}
+
+// age scales every rank down and drops entries that fall below minRank.
+func age(entries []Entry) []Entry {
+	kept := entries[:0]
+	for _, e := range entries {
+		e.Rank *= agingFactor
+		if e.Rank >= minRank {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// decode reads a history file. Entries whose path is not absolute, which
+// only a hand edit leaves, are dropped.
+func decode(data []byte) ([]Entry, error) {
+	var entries []Entry
+	if len(data) == 0 {
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if filepath.IsAbs(e.Path) {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
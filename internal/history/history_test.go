@@ -0,0 +1,103 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.json")
+	now := time.Now()
+
+	for _, dir := range []string{"/a", "/b", "/b", "/b/"} {
+		if err := Add(file, dir, now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	entries, err := Load(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Path != "/b" || entries[0].Rank != 3 {
+		t.Errorf("expected /b with rank 3 first, got %s with rank %v", entries[0].Path, entries[0].Rank)
+	}
+}
+
+func TestLoadDropsRelativePaths(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.json")
+	data := `[{"path": "foo", "rank": 5}, {"path": "/a", "rank": 1}, {"path": "", "rank": 1}]`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := Load(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/a" {
+		t.Errorf("expected only /a, got %v", entries)
+	}
+	if err := Add(file, "bar", time.Now()); err == nil {
+		t.Error("expected an error adding a relative path")
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	entries, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %d", len(entries))
+	}
+}
+
+func TestFrecencyPrefersRecent(t *testing.T) {
+	now := time.Now()
+	recent := Entry{Path: "/recent", Rank: 2, LastAccess: now.Add(-time.Minute)}
+	stale := Entry{Path: "/stale", Rank: 10, LastAccess: now.Add(-30 * 24 * time.Hour)}
+	if recent.Frecency(now) <= stale.Frecency(now) {
+		t.Errorf("expected recent (%v) > stale (%v)", recent.Frecency(now), stale.Frecency(now))
+	}
+}
+
+func TestAgeDropsLowRanks(t *testing.T) {
+	entries := age([]Entry{{Path: "/keep", Rank: 100}, {Path: "/drop", Rank: 1}})
+	if len(entries) != 1 || entries[0].Path != "/keep" {
+		t.Fatalf("expected only /keep to survive, got %+v", entries)
+	}
+	if entries[0].Rank != 90 {
+		t.Errorf("expected rank 90, got %v", entries[0].Rank)
+	}
+}
+
+func TestAddConcurrent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.json")
+	now := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Add(file, "/same", now); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := Load(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Rank != 20 {
+		t.Errorf("expected one entry with rank 20, got %+v", entries)
+	}
+}
@@ -0,0 +1,95 @@
+// Package project recognizes project roots by the marker files they
+// contain, such as go.mod or package.json.
+package project
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type Marker struct {
+	// File is the name of the marker file.
+	File string `json:"file"`
+	// Kind names the kind of project it marks, e.g. "go".
+	Kind string `json:"kind"`
+}
+
+// DefaultMarkers lists the markers recognized out of the box, most specific
+// first: a Go module with a Makefile is a Go project.
+var DefaultMarkers = []Marker{
+	{File: "go.mod", Kind: "go"},
+	{File: "Cargo.toml", Kind: "rust"},
+	{File: "package.json", Kind: "node"},
+	{File: "pyproject.toml", Kind: "python"},
+	{File: "Makefile", Kind: "make"},
+}
+
+var ErrInvalidMarker = errors.New("invalid project marker")
+
+// ParseMarker parses a "FILE[:KIND]" marker. The kind defaults to the file
+// name.
+func ParseMarker(s string) (Marker, error) {
+	file, kind, _ := strings.Cut(s, ":")
+	file = strings.TrimSpace(file)
+	kind = strings.TrimSpace(kind)
+	if file == "" || strings.ContainsRune(file, '/') {
+		return Marker{}, fmt.Errorf("%w: %q (expected FILE[:KIND])", ErrInvalidMarker, s)
+	}
+	if kind == "" {
+		kind = file
+	}
+	return Marker{File: file, Kind: kind}, nil
+}
+
+// Matcher finds the marker of a directory from the names it contains.
+type Matcher struct {
+	markers  []Marker
+	priority map[string]int
+}
+
+// NewMatcher returns a Matcher for markers, earlier ones taking precedence
+// when a directory has several. It returns nil when there are no markers.
+func NewMatcher(markers []Marker) *Matcher {
+	if len(markers) == 0 {
+		return nil
+	}
+	m := &Matcher{markers: markers, priority: make(map[string]int, len(markers))}
+	for i, marker := range markers {
+		if _, ok := m.priority[marker.File]; !ok {
+			m.priority[marker.File] = i
+		}
+	}
+	return m
+}
+
+// Kind returns the kind of project marked by the names of a directory's
+// children, or "" if it is not a project root.
+func (m *Matcher) Kind(names []string) string {
+	best := len(m.markers)
+	for _, name := range names {
+		if i, ok := m.priority[name]; ok && i < best {
+			best = i
+		}
+	}
+	if best == len(m.markers) {
+		return ""
+	}
+	return m.markers[best].Kind
+}
+
+// Detect reads dir and returns the kind of project it is the root of, or
+// "" if it is not one.
+func (m *Matcher) Detect(dir string) (string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return "", err
+	}
+	return m.Kind(names), nil
+}
@@ -0,0 +1,55 @@
+package project
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKindPrefersEarlierMarkers(t *testing.T) {
+	m := NewMatcher(DefaultMarkers)
+	for _, tt := range []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"Makefile", "main.go", "go.mod"}, "go"},
+		{[]string{"Makefile", "README.md"}, "make"},
+		{[]string{"src", "README.md"}, ""},
+	} {
+		if got := m.Kind(tt.names); got != tt.want {
+			t.Errorf("Kind(%v) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestParseMarker(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Marker
+	}{
+		{"build.gradle:java", Marker{File: "build.gradle", Kind: "java"}},
+		{"WORKSPACE", Marker{File: "WORKSPACE", Kind: "WORKSPACE"}},
+	} {
+		got, err := ParseMarker(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMarker(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", ":go", "sub/go.mod"} {
+		if _, err := ParseMarker(in); !errors.Is(err, ErrInvalidMarker) {
+			t.Errorf("ParseMarker(%q): expected %v, got %v", in, ErrInvalidMarker, err)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Cargo.toml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kind, err := NewMatcher(DefaultMarkers).Detect(dir)
+	if err != nil || kind != "rust" {
+		t.Errorf("expected rust, got %q, %v", kind, err)
+	}
+}
@@ -0,0 +1,195 @@
+package ranker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sakolb/bcd/internal/entry"
+)
+
+// Explanation breaks an entry's score down into the parts it is made of,
+// to tell why one result ranks above another.
+type Explanation struct {
+	Query   string `json:"query"`
+	Path    string `json:"path"`
+	Matched bool   `json:"matched"`
+	// Score is the total: Fuzzy + Bias + Project + Recency
+	Score int `json:"score"`
+	// Fuzzy is the match score: the sum of Chars plus Gaps
+	Fuzzy int         `json:"fuzzy"`
+	Chars []CharScore `json:"chars,omitempty"`
+	// Gaps is the penalty for the characters skipped after the first match
+	Gaps int `json:"gaps"`
+	// Bias is what the source adds, such as the history's frecency
+	Bias    int    `json:"bias"`
+	Project int    `json:"project"`
+	Kind    string `json:"kind,omitempty"`
+	Recency int    `json:"recency"`
+	// Distance breaks ties between equal scores, nearest first
+	Distance int `json:"distance"`
+}
+
+// CharScore is what one query character earned where it matched.
+type CharScore struct {
+	Char string `json:"char"`
+	// Position is the index of the matched character in the path, in runes
+	Position int `json:"position"`
+	Match    int `json:"match"`
+	// Bonus is earned at the start of the path or after a separator
+	Bonus     int    `json:"bonus,omitempty"`
+	BonusKind string `json:"bonus_kind,omitempty"`
+	// Consecutive is earned right after the previous match, GapStart is
+	// paid when characters were skipped since then
+	Consecutive int `json:"consecutive,omitempty"`
+	GapStart    int `json:"gap_start,omitempty"`
+}
+
+// Positions returns the matched positions in the path.
+func (x Explanation) Positions() []int {
+	positions := make([]int, len(x.Chars))
+	for i, c := range x.Chars {
+		positions[i] = c.Position
+	}
+	return positions
+}
+
+// Explain breaks down the score e gets for query, including the source's
+// bias and the weighted signals. It only reads the Ranker's bias and
+// weights, so it can be called while another goroutine ranks.
+func (r *Ranker) Explain(query string, e *entry.PathEntry) Explanation {
+	x := Explain(query, e.AbsPath())
+	if r.bias != nil {
+		x.Bias = r.bias(e)
+	}
+	x.Project = r.weights.projectBonus(e)
+	x.Kind = e.Project
+	x.Recency = r.weights.recencyBonus(e, time.Now())
+	x.Distance = e.Distance
+	x.Score = x.Fuzzy + x.Bias + x.Project + x.Recency
+	return x
+}
+
+// Explain breaks down the fuzzy score of target for query, as Score
+// computes it. An empty query matches everything with no fuzzy score.
+func Explain(query, target string) Explanation {
+	x := Explanation{Query: query, Path: target}
+	if query == "" {
+		x.Matched = true
+		return x
+	}
+	t, ok := fill(query, target)
+	if !ok {
+		return x
+	}
+	x.Matched = true
+	x.Fuzzy = t.H[len(t.query)][len(t.target)]
+
+	// Walk back from the best score the way it was built: along H while
+	// characters were skipped, then through the match that ended there.
+	// A consecutive match must follow the previous query character's match
+	// directly, without skipping
+	chars := make([]CharScore, len(t.query))
+	i, j := len(t.query), len(t.target)
+	skipped := 0
+	consecutive := false
+	for i > 0 {
+		if !consecutive {
+			for t.H[i][j] != t.M[i][j] {
+				j--
+				skipped++
+			}
+		}
+		c := CharScore{Char: string(t.original[j-1]), Position: j - 1, Match: scoreMatch}
+		if j == 1 {
+			c.Bonus, c.BonusKind = bonusFirstChar, "first char"
+		} else if t.original[j-2] == '/' {
+			c.Bonus, c.BonusKind = bonusPathSeparator, "separator"
+		}
+		consecutive = false
+		if i > 1 {
+			if t.M[i-1][j-1] > negInf && t.M[i][j] == t.M[i-1][j-1]+scoreMatch+c.Bonus+bonusConsecutive {
+				c.Consecutive = bonusConsecutive
+				consecutive = true
+			} else {
+				c.GapStart = scoreGapStart
+			}
+		}
+		chars[i-1] = c
+		i--
+		j--
+	}
+	x.Chars = chars
+	x.Gaps = skipped * scoreGapExtension
+	return x
+}
+
+// WriteText writes the explanation as an aligned, human-readable table.
+func (x Explanation) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", x.Path)
+	fmt.Fprintf(&b, "  query     %q\n", x.Query)
+	if !x.Matched {
+		b.WriteString("  no match\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	fmt.Fprintf(&b, "  score     %d\n", x.Score)
+	fmt.Fprintf(&b, "  fuzzy     %+d\n", x.Fuzzy)
+	for _, c := range x.Chars {
+		fmt.Fprintf(&b, "    %-2s at %-4d match %+d", c.Char, c.Position, c.Match)
+		if c.Bonus != 0 {
+			fmt.Fprintf(&b, "  %s %+d", c.BonusKind, c.Bonus)
+		}
+		if c.Consecutive != 0 {
+			fmt.Fprintf(&b, "  consecutive %+d", c.Consecutive)
+		}
+		if c.GapStart != 0 {
+			fmt.Fprintf(&b, "  gap %+d", c.GapStart)
+		}
+		b.WriteString("\n")
+	}
+	if x.Query != "" {
+		fmt.Fprintf(&b, "    gaps %+d (%d characters skipped)\n", x.Gaps, x.Gaps/scoreGapExtension)
+	}
+	fmt.Fprintf(&b, "  bias      %+d\n", x.Bias)
+	if x.Kind != "" {
+		fmt.Fprintf(&b, "  project   %+d (%s)\n", x.Project, x.Kind)
+	} else {
+		fmt.Fprintf(&b, "  project   %+d\n", x.Project)
+	}
+	fmt.Fprintf(&b, "  recency   %+d\n", x.Recency)
+	fmt.Fprintf(&b, "  distance  %d\n", x.Distance)
+	if len(x.Chars) > 0 {
+		fmt.Fprintf(&b, "  matched   %s\n", x.Highlight("[", "]"))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Highlight returns the path with runs of matched characters wrapped in
+// open and close.
+func (x Explanation) Highlight(open, close string) string {
+	matched := make(map[int]bool, len(x.Chars))
+	for _, c := range x.Chars {
+		matched[c.Position] = true
+	}
+	var b strings.Builder
+	in := false
+	for i, r := range []rune(x.Path) {
+		if matched[i] != in {
+			if in {
+				b.WriteString(close)
+			} else {
+				b.WriteString(open)
+			}
+			in = !in
+		}
+		b.WriteRune(r)
+	}
+	if in {
+		b.WriteString(close)
+	}
+	return b.String()
+}
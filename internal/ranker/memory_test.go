@@ -0,0 +1,69 @@
+package ranker
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/entry"
+)
+
+// addTree adds n entries to r, as a crawl of a source tree would: 40
+// entries per directory, 25 directories per level below a few projects.
+func addTree(b *testing.B, r *Ranker, n int) {
+	const base = "/home/user"
+	batch := make([]*entry.PathEntry, 0, 1000)
+	add := func(path string, t entry.FileType) {
+		e, err := entry.NewPathEntryWithType(path, base, t)
+		if err != nil {
+			b.Fatal(err)
+		}
+		e.Origin = entry.OriginOf("crawl")
+		batch = append(batch, e)
+		if len(batch) == cap(batch) {
+			r.AddEntryBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	count := 0
+	for project := 0; count < n; project++ {
+		for pkg := 0; pkg < 25 && count < n; pkg++ {
+			for sub := 0; sub < 25 && count < n; sub++ {
+				dir := fmt.Sprintf("%s/src/github.com/example/project-%03d/internal/package%02d/module%02d", base, project, pkg, sub)
+				add(dir, entry.FileTypeDir)
+				count++
+				for file := 0; file < 39 && count < n; file++ {
+					add(fmt.Sprintf("%s/source_file_%02d.go", dir, file), entry.FileTypeFile)
+					count++
+				}
+			}
+		}
+	}
+	r.AddEntryBatch(batch)
+}
+
+// heapInUse returns the bytes of live heap, after a collection.
+func heapInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// BenchmarkMemory measures the heap held by a ranker of crawled entries, as
+// in the picker, per entry and in total. Run it with -benchtime=1x.
+func BenchmarkMemory(b *testing.B) {
+	for _, n := range []int{1_000_000, 5_000_000} {
+		b.Run(fmt.Sprintf("entries=%d", n), func(b *testing.B) {
+			for b.Loop() {
+				before := heapInUse()
+				r := NewRanker()
+				addTree(b, r, n)
+				held := heapInUse() - before
+				runtime.KeepAlive(r)
+				b.ReportMetric(float64(held)/float64(n), "B/entry")
+				b.ReportMetric(float64(held)/(1<<20), "MiB")
+			}
+		})
+	}
+}
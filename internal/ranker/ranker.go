@@ -2,7 +2,13 @@ package ranker
 
 import (
 	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sakolb/bcd/internal/entry"
 )
@@ -29,11 +35,19 @@ func (h ResultsHeap) Len() int { return len(h) }
 
 func (h ResultsHeap) Less(i, j int) bool {
 	// Max-heap: higher scores come first
-	if h[i].Score != h[j].Score {
-		return h[i].Score > h[j].Score
+	return better(h[i], h[j])
+}
+
+// better reports whether a ranks above b: by score, then distance (closer
+// is better), then modification time (recent is better).
+func better(a, b ScoredEntry) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	if a.Entry.Distance != b.Entry.Distance {
+		return a.Entry.Distance < b.Entry.Distance
 	}
-	// Tie-break by distance (closer is better)
-	return h[i].Entry.Distance < h[j].Entry.Distance
+	return a.Entry.ModTime.After(b.Entry.ModTime)
 }
 
 func (h ResultsHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
@@ -51,24 +65,154 @@ func (h *ResultsHeap) Pop() any {
 	return element
 }
 
+// BiasFunc returns an adjustment added to an entry's score. Sources use it
+// to rank by signals other than the fuzzy match, such as frecency; with an
+// empty query the bias alone orders the results.
+type BiasFunc func(e *entry.PathEntry) int
+
+// Weights tune the signals every Ranker adds to the fuzzy score, whatever
+// the source.
+type Weights struct {
+	// Project is the bonus of project roots, so that a search lands on a
+	// module rather than on directories inside it
+	Project int
+	// Recency is the bonus of an entry modified just now. It halves every
+	// HalfLife, so that stale copies rank below the live working directory
+	Recency  int
+	HalfLife time.Duration
+}
+
+func DefaultWeights() Weights {
+	return Weights{
+		Project:  24,
+		Recency:  16,
+		HalfLife: 7 * 24 * time.Hour,
+	}
+}
+
+var ErrInvalidWeight = errors.New("invalid weight")
+
+// Set changes the weight called name: "project", "recency" or
+// "half-life", a duration such as 72h.
+func (w *Weights) Set(name string, value string) error {
+	var err error
+	switch name {
+	case "project":
+		w.Project, err = strconv.Atoi(value)
+	case "recency":
+		w.Recency, err = strconv.Atoi(value)
+	case "half-life":
+		w.HalfLife, err = time.ParseDuration(value)
+		if err == nil && w.HalfLife <= 0 {
+			err = errors.New("must be positive")
+		}
+	default:
+		return fmt.Errorf("%w: unknown weight %q (expected project, recency or half-life)", ErrInvalidWeight, name)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s=%s: %v", ErrInvalidWeight, name, value, err)
+	}
+	return nil
+}
+
+// ParseWeight sets a "NAME=VALUE" weight in w.
+func (w *Weights) ParseWeight(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%w: %q (expected NAME=VALUE)", ErrInvalidWeight, s)
+	}
+	return w.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+}
+
+// bonus returns the score e gets from the weighted signals at time now.
+func (w Weights) bonus(e *entry.PathEntry, now time.Time) int {
+	return w.projectBonus(e) + w.recencyBonus(e, now)
+}
+
+func (w Weights) projectBonus(e *entry.PathEntry) int {
+	if e.Project == "" {
+		return 0
+	}
+	return w.Project
+}
+
+func (w Weights) recencyBonus(e *entry.PathEntry, now time.Time) int {
+	if w.Recency == 0 || w.HalfLife <= 0 || e.ModTime.IsZero() {
+		return 0
+	}
+	age := now.Sub(e.ModTime)
+	if age < 0 {
+		age = 0
+	}
+	return int(math.Round(float64(w.Recency) * math.Exp2(-float64(age)/float64(w.HalfLife))))
+}
+
+// SortMode orders a Ranker's results. Whatever the mode, only entries
+// matching the query are results.
+type SortMode string
+
+const (
+	// SortScore orders by fuzzy score plus bias, then distance
+	SortScore SortMode = "score"
+	// SortDistance orders by distance from the base directory
+	SortDistance SortMode = "distance"
+	// SortMTime puts the most recently modified entries first
+	SortMTime SortMode = "mtime"
+	// SortName orders by base name
+	SortName SortMode = "name"
+)
+
+// SortModes lists every sort mode, in the order they are cycled through.
+var SortModes = []SortMode{SortScore, SortDistance, SortMTime, SortName}
+
+var ErrInvalidSortMode = errors.New("invalid sort mode")
+
+func ParseSortMode(s string) (SortMode, error) {
+	for _, mode := range SortModes {
+		if string(mode) == s {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q (expected score, distance, mtime or name)", ErrInvalidSortMode, s)
+}
+
 type Ranker struct {
 	entries       []*entry.PathEntry
 	query         string
 	previousQuery string
 	resultsHeap   *ResultsHeap
+	bias          BiasFunc
+	weights       Weights
+	// types restricts results to these file types; nil allows every type
+	types map[entry.FileType]bool
+	sort  SortMode
 }
 
 func NewRanker() *Ranker {
+	return NewRankerWithBias(nil)
+}
+
+// NewRankerWithBias returns a Ranker that adds bias to every score. A nil
+// bias ranks by fuzzy score and distance only.
+func NewRankerWithBias(bias BiasFunc) *Ranker {
 	h := &ResultsHeap{}
 	return &Ranker{
 		entries:     make([]*entry.PathEntry, 0),
 		resultsHeap: h,
+		bias:        bias,
+		weights:     DefaultWeights(),
+		sort:        SortScore,
 	}
 }
 
+// Entries returns the entries added and not removed since. The slice is
+// the ranker's own, only valid until the ranker is next changed.
+func (r *Ranker) Entries() []*entry.PathEntry {
+	return r.entries
+}
+
 func (r *Ranker) AddEntry(e *entry.PathEntry) {
-	r.entries = append(r.entries, e)
-	// Don't score individual entries - use AddEntryBatch instead
+	r.AddEntryBatch([]*entry.PathEntry{e})
 }
 
 func (r *Ranker) AddEntryBatch(batch []*entry.PathEntry) {
@@ -76,16 +220,30 @@ func (r *Ranker) AddEntryBatch(batch []*entry.PathEntry) {
 
 	// Score each entry in batch and insert into heap
 	for _, e := range batch {
-		if r.query != "" {
-			matched, s := score(r.query, e.AbsPath)
-			if matched {
-				heap.Push(r.resultsHeap, ScoredEntry{Entry: e, Score: s})
-			}
-		} else {
-			// No query = show all, sorted by distance
-			heap.Push(r.resultsHeap, ScoredEntry{Entry: e, Score: 0})
+		r.pushIfMatched(e)
+	}
+}
+
+// pushIfMatched scores e against the current query and adds it to the heap
+// if it matches. An empty query matches everything, sorted by bias and
+// then distance.
+func (r *Ranker) pushIfMatched(e *entry.PathEntry) {
+	if r.types != nil && !r.types[e.FType] {
+		return
+	}
+	s := 0
+	if r.query != "" {
+		matched, fuzzy := score(r.query, e.AbsPath())
+		if !matched {
+			return
 		}
+		s = fuzzy
+	}
+	if r.bias != nil {
+		s += r.bias(e)
 	}
+	s += r.weights.bonus(e, time.Now())
+	heap.Push(r.resultsHeap, ScoredEntry{Entry: e, Score: s})
 }
 
 func (r *Ranker) SetQuery(q string) {
@@ -100,6 +258,103 @@ func (r *Ranker) SetQuery(q string) {
 	r.rebuildHeap()
 }
 
+// Remove drops the entries at paths and every entry below them, returning
+// how many were removed.
+func (r *Ranker) Remove(paths ...string) int {
+	dirs := make(map[entry.Path]bool, len(paths))
+	for _, path := range paths {
+		dirs[entry.MakePath(path)] = true
+	}
+
+	kept := r.entries[:0]
+	for _, e := range r.entries {
+		if !withinAny(e.Path, dirs) {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(r.entries) - len(kept)
+	clear(r.entries[len(kept):])
+	r.entries = kept
+	if removed == 0 {
+		return 0
+	}
+
+	h := (*r.resultsHeap)[:0]
+	for _, scored := range *r.resultsHeap {
+		if !withinAny(scored.Entry.Path, dirs) {
+			h = append(h, scored)
+		}
+	}
+	*r.resultsHeap = h
+	heap.Init(r.resultsHeap)
+	return removed
+}
+
+// Rename moves the entry at oldPath and every entry below it to newPath,
+// rescoring them against the current query. Renamed entries are copies,
+// so entries shared with other rankers are left alone.
+func (r *Ranker) Rename(oldPath string, newPath string) {
+	renamed := false
+	old := entry.MakePath(oldPath)
+	for i, e := range r.entries {
+		if within(e.Path, old) {
+			r.entries[i] = e.Moved(newPath + strings.TrimPrefix(e.AbsPath(), oldPath))
+			renamed = true
+		}
+	}
+	if renamed {
+		r.resultsHeap = &ResultsHeap{}
+		heap.Init(r.resultsHeap)
+		r.scoreAllEntries()
+	}
+}
+
+// within reports whether path is dir or below it.
+func within(path entry.Path, dir entry.Path) bool {
+	for {
+		if path == dir {
+			return true
+		}
+		parent := path.Dir()
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// withinAny reports whether path or one of its parents is in dirs.
+func withinAny(path entry.Path, dirs map[entry.Path]bool) bool {
+	for {
+		if dirs[path] {
+			return true
+		}
+		parent := path.Dir()
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+// SetTypes restricts the results to entries of the given file types. An
+// empty list allows every type again.
+func (r *Ranker) SetTypes(types []entry.FileType) {
+	if len(types) == 0 {
+		r.types = nil
+	} else {
+		r.types = make(map[entry.FileType]bool, len(types))
+		for _, t := range types {
+			r.types[t] = true
+		}
+	}
+
+	// Entries filtered out before may match now, so rescore everything
+	r.resultsHeap = &ResultsHeap{}
+	heap.Init(r.resultsHeap)
+	r.scoreAllEntries()
+}
+
 func (r *Ranker) rebuildHeap() {
 	// Detect incremental query for optimization
 	if r.previousQuery != "" && strings.HasPrefix(r.query, r.previousQuery) && len(r.query) > len(r.previousQuery) {
@@ -115,20 +370,9 @@ func (r *Ranker) rebuildHeap() {
 }
 
 func (r *Ranker) scoreAllEntries() {
-	if r.query == "" {
-		// No query: show all by distance
-		for _, e := range r.entries {
-			heap.Push(r.resultsHeap, ScoredEntry{Entry: e, Score: 0})
-		}
-		return
-	}
-
 	// Score all entries and push to heap
 	for _, e := range r.entries {
-		matched, s := score(r.query, e.AbsPath)
-		if matched {
-			heap.Push(r.resultsHeap, ScoredEntry{Entry: e, Score: s})
-		}
+		r.pushIfMatched(e)
 	}
 }
 
@@ -146,27 +390,155 @@ func (r *Ranker) scoreMatchedEntries() {
 
 	// Only rescore entries that matched before
 	for _, e := range matchedEntries {
-		matched, s := score(r.query, e.AbsPath)
-		if matched {
-			heap.Push(r.resultsHeap, ScoredEntry{Entry: e, Score: s})
-		}
+		r.pushIfMatched(e)
 	}
 }
 
+// SetWeights changes the weights of the signals added to fuzzy scores,
+// rescoring every entry.
+func (r *Ranker) SetWeights(w Weights) {
+	r.weights = w
+	r.resultsHeap = &ResultsHeap{}
+	heap.Init(r.resultsHeap)
+	r.scoreAllEntries()
+}
+
+// SetSort changes the order of the results. Scores are unaffected.
+func (r *Ranker) SetSort(mode SortMode) {
+	r.sort = mode
+}
+
+// Matches returns the number of entries matching the query, without
+// sorting them as Results does.
+func (r *Ranker) Matches() int {
+	return r.resultsHeap.Len()
+}
+
+// Results returns every result, in the order of the sort mode. It sorts
+// them all; Top is cheaper when only the first are shown.
 func (r *Ranker) Results() []ScoredEntry {
-	// Return heap as sorted slice (heap is already sorted)
-	// Make a copy to avoid modifying the heap
+	// The heap only guarantees its first element is the best one, so sort
+	// a copy to return results in rank order without modifying the heap
 	results := make([]ScoredEntry, len(*r.resultsHeap))
 	copy(results, *r.resultsHeap)
+	before := r.before()
+	sort.Slice(results, func(i, j int) bool { return before(results[i], results[j]) })
 	return results
 }
 
+// Top returns the first n results, in the order of the sort mode, without
+// sorting the rest.
+func (r *Ranker) Top(n int) []ScoredEntry {
+	if n >= r.resultsHeap.Len() {
+		return r.Results()
+	}
+	before := r.before()
+	// top is a heap of the best results so far with the worst of them
+	// first, to be replaced by anything better
+	top := &boundedHeap{before: before}
+	for _, s := range *r.resultsHeap {
+		switch {
+		case len(top.results) < n:
+			heap.Push(top, s)
+		case n > 0 && before(s, top.results[0]):
+			top.results[0] = s
+			heap.Fix(top, 0)
+		}
+	}
+	results := top.results
+	sort.Slice(results, func(i, j int) bool { return before(results[i], results[j]) })
+	return results
+}
+
+// before returns whether a comes before b in the sort mode's order.
+func (r *Ranker) before() func(a, b ScoredEntry) bool {
+	switch r.sort {
+	case SortDistance:
+		return func(a, b ScoredEntry) bool {
+			if d := a.Entry.Distance - b.Entry.Distance; d != 0 {
+				return d < 0
+			}
+			return better(a, b)
+		}
+	case SortMTime:
+		return func(x, y ScoredEntry) bool {
+			a, b := x.Entry.ModTime, y.Entry.ModTime
+			switch {
+			case a.IsZero() != b.IsZero():
+				// Entries modified at an unknown time come last
+				return b.IsZero()
+			case !a.Equal(b):
+				return a.After(b)
+			}
+			return better(x, y)
+		}
+	case SortName:
+		return func(x, y ScoredEntry) bool {
+			a := strings.ToLower(x.Entry.Path.Base())
+			b := strings.ToLower(y.Entry.Path.Base())
+			if a != b {
+				return a < b
+			}
+			return x.Entry.AbsPath() < y.Entry.AbsPath()
+		}
+	}
+	return better
+}
+
+// boundedHeap holds the best results found by Top, the worst first.
+type boundedHeap struct {
+	results []ScoredEntry
+	before  func(a, b ScoredEntry) bool
+}
+
+func (h *boundedHeap) Len() int           { return len(h.results) }
+func (h *boundedHeap) Less(i, j int) bool { return h.before(h.results[j], h.results[i]) }
+func (h *boundedHeap) Swap(i, j int)      { h.results[i], h.results[j] = h.results[j], h.results[i] }
+func (h *boundedHeap) Push(x any)         { h.results = append(h.results, x.(ScoredEntry)) }
+func (h *boundedHeap) Pop() any {
+	n := len(h.results)
+	last := h.results[n-1]
+	h.results = h.results[:n-1]
+	return last
+}
+
+// Score reports whether target fuzzy matches query, and how well. It is
+// the same scoring the Ranker uses, for callers that match something other
+// than an entry's full path.
+func Score(query, target string) (bool, int) {
+	return score(query, target)
+}
+
 func score(query, target string) (bool, int) {
+	t, ok := fill(query, target)
+	if !ok {
+		return false, 0
+	}
+	return true, t.H[len(t.query)][len(t.target)]
+}
+
+// negInf marks impossible states in the dynamic programming tables.
+const negInf = -100000
+
+// table holds the dynamic programming state of a fuzzy match, from which
+// both the score and the matched positions can be read.
+type table struct {
+	query    []rune
+	target   []rune
+	original []rune
+	// M[i][j] = best score when query[i-1] matches at target[j-1]
+	// H[i][j] = best overall score for query[0..i-1] in target[0..j-1]
+	M [][]int
+	H [][]int
+}
+
+// fill runs the FZF v2 algorithm, reporting whether query matches target.
+func fill(query, target string) (*table, bool) {
 	queryLower := strings.ToLower(query)
 	targetLower := strings.ToLower(target)
 
 	if len(queryLower) == 0 {
-		return false, 0
+		return nil, false
 	}
 
 	queryRunes := []rune(queryLower)
@@ -181,15 +553,13 @@ func score(query, target string) (bool, int) {
 		}
 	}
 	if q_idx < len(queryRunes) {
-		return false, 0
+		return nil, false
 	}
 
 	// FZF v2 algorithm: Dynamic programming to find optimal match positions
 	qLen := len(queryRunes)
 	tgLen := len(targetRunes)
 
-	const negInf = -100000
-
 	// M[i][j] = best score when query[i-1] matches at target[j-1]
 	// H[i][j] = best overall score for query[0..i-1] in target[0..j-1]
 	M := make([][]int, qLen+1)
@@ -244,7 +614,7 @@ func score(query, target string) (bool, int) {
 		}
 	}
 
-	return true, H[qLen][tgLen]
+	return &table{query: queryRunes, target: targetRunes, original: originalRunes, M: M, H: H}, true
 }
 
 func max(a, b int) int {
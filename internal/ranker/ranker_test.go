@@ -1,7 +1,12 @@
 package ranker
 
 import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sakolb/bcd/internal/entry"
 )
@@ -40,7 +45,7 @@ func TestScoreRanking(t *testing.T) {
 		worse  string
 	}{
 		// Consecutive matches beat scattered
-		{"cfg", "config", "c-f-g"},
+		{"cfg", "my-cfg", "c-f-g"},
 		// Match at path boundary beats mid-word
 		{"cfg", "/home/cfg", "/home/xcfg"},
 		// Match at start beats mid-string
@@ -77,9 +82,9 @@ func TestRankerEmptyQuery(t *testing.T) {
 
 	// Create mock entries with different distances
 	entries := []*entry.PathEntry{
-		{AbsPath: "/home/user/far", Distance: 3},
-		{AbsPath: "/home/close", Distance: 1},
-		{AbsPath: "/home/user/middle", Distance: 2},
+		{Path: entry.MakePath("/home/user/far"), Distance: 3},
+		{Path: entry.MakePath("/home/close"), Distance: 1},
+		{Path: entry.MakePath("/home/user/middle"), Distance: 2},
 	}
 
 	for _, e := range entries {
@@ -106,10 +111,10 @@ func TestRankerFiltersAndSorts(t *testing.T) {
 	r := NewRanker()
 
 	entries := []*entry.PathEntry{
-		{AbsPath: "/home/user/config", Distance: 2},
-		{AbsPath: "/home/cfg", Distance: 1},
-		{AbsPath: "/home/user/nomatch", Distance: 1},
-		{AbsPath: "/etc/config", Distance: 3},
+		{Path: entry.MakePath("/home/user/config"), Distance: 2},
+		{Path: entry.MakePath("/home/cfg"), Distance: 1},
+		{Path: entry.MakePath("/home/user/nomatch"), Distance: 1},
+		{Path: entry.MakePath("/etc/config"), Distance: 3},
 	}
 
 	for _, e := range entries {
@@ -126,9 +131,9 @@ func TestRankerFiltersAndSorts(t *testing.T) {
 
 	// All results should match
 	for _, res := range results {
-		matched, _ := score("cfg", res.Entry.AbsPath)
+		matched, _ := score("cfg", res.Entry.AbsPath())
 		if !matched {
-			t.Errorf("result %q should not be in results", res.Entry.AbsPath)
+			t.Errorf("result %q should not be in results", res.Entry.AbsPath())
 		}
 	}
 
@@ -149,9 +154,9 @@ func TestRankerUpdateQuery(t *testing.T) {
 	r := NewRanker()
 
 	entries := []*entry.PathEntry{
-		{AbsPath: "/home/user/config", Distance: 1},
-		{AbsPath: "/home/user/cache", Distance: 1},
-		{AbsPath: "/home/user/code", Distance: 1},
+		{Path: entry.MakePath("/home/user/config"), Distance: 1},
+		{Path: entry.MakePath("/home/user/cache"), Distance: 1},
+		{Path: entry.MakePath("/home/user/code"), Distance: 1},
 	}
 
 	for _, e := range entries {
@@ -172,7 +177,7 @@ func TestRankerUpdateQuery(t *testing.T) {
 	// "cache" should match exactly one entry
 	found := false
 	for _, res := range results2 {
-		if res.Entry.AbsPath == "/home/user/cache" {
+		if res.Entry.AbsPath() == "/home/user/cache" {
 			found = true
 			break
 		}
@@ -195,3 +200,295 @@ func TestDebugFourthMatch(t *testing.T) {
 		t.Logf("score(%q, %q) = matched:%v score:%d", "cfg", target, matched, s)
 	}
 }
+
+func TestRankerBias(t *testing.T) {
+	boosted := &entry.PathEntry{Path: entry.MakePath("/far/away/config"), Distance: 5}
+	r := NewRankerWithBias(func(e *entry.PathEntry) int {
+		if e == boosted {
+			return 100
+		}
+		return 0
+	})
+
+	r.AddEntryBatch([]*entry.PathEntry{
+		{Path: entry.MakePath("/home/config"), Distance: 1},
+		boosted,
+	})
+
+	// Without a query the bias alone decides the order
+	results := r.Results()
+	if len(results) != 2 || results[0].Entry != boosted {
+		t.Fatalf("expected boosted entry first, got %+v", results)
+	}
+
+	r.SetQuery("config")
+	results = r.Results()
+	if len(results) != 2 || results[0].Entry != boosted {
+		t.Fatalf("expected boosted entry first for query, got %+v", results)
+	}
+}
+
+func TestRankerTypes(t *testing.T) {
+	r := NewRanker()
+	r.AddEntryBatch([]*entry.PathEntry{
+		{Path: entry.MakePath("/a/config"), FType: entry.FileTypeDir},
+		{Path: entry.MakePath("/a/config.yaml"), FType: entry.FileTypeFile},
+		{Path: entry.MakePath("/a/config.link"), FType: entry.FileTypeSymlink},
+	})
+	r.SetQuery("config")
+
+	r.SetTypes([]entry.FileType{entry.FileTypeDir})
+	results := r.Results()
+	if len(results) != 1 || results[0].Entry.AbsPath() != "/a/config" {
+		t.Fatalf("expected only the directory, got %+v", results)
+	}
+
+	// Entries added later are filtered too
+	r.AddEntry(&entry.PathEntry{Path: entry.MakePath("/b/config.txt"), FType: entry.FileTypeFile})
+	if len(r.Results()) != 1 {
+		t.Errorf("expected the new file to be filtered out, got %+v", r.Results())
+	}
+
+	r.SetTypes(nil)
+	if len(r.Results()) != 4 {
+		t.Errorf("expected all 4 entries, got %d", len(r.Results()))
+	}
+}
+
+func TestRankerRemoveAndRename(t *testing.T) {
+	r := NewRanker()
+	r.AddEntryBatch([]*entry.PathEntry{
+		{Path: entry.MakePath("/a/proj"), FType: entry.FileTypeDir},
+		{Path: entry.MakePath("/a/proj/src"), FType: entry.FileTypeDir},
+		{Path: entry.MakePath("/a/project-notes"), FType: entry.FileTypeDir},
+	})
+	r.SetQuery("proj")
+
+	r.Rename("/a/proj", "/a/work")
+	results := r.Results()
+	if len(results) != 1 || results[0].Entry.AbsPath() != "/a/project-notes" {
+		t.Fatalf("expected only /a/project-notes to match, got %+v", results)
+	}
+
+	r.SetQuery("work")
+	if len(r.Results()) != 2 {
+		t.Fatalf("expected the renamed entries to match, got %+v", r.Results())
+	}
+
+	// Removing a directory removes everything below it, but not siblings
+	// sharing its prefix
+	if n := r.Remove("/a/work"); n != 2 {
+		t.Errorf("expected 2 entries removed, got %d", n)
+	}
+	r.SetQuery("")
+	results = r.Results()
+	if len(results) != 1 || results[0].Entry.AbsPath() != "/a/project-notes" {
+		t.Errorf("expected only /a/project-notes left, got %+v", results)
+	}
+
+	// Several at once, as after a tree was deleted
+	r.AddEntryBatch([]*entry.PathEntry{{Path: entry.MakePath("/b/x/y")}, {Path: entry.MakePath("/b/z")}, {Path: entry.MakePath("/bx")}})
+	if n := r.Remove("/b/x", "/b/z", "/a/project-notes/missing"); n != 2 {
+		t.Errorf("expected 2 entries removed, got %d", n)
+	}
+	if n := r.Remove("/"); n != 2 {
+		t.Errorf("expected the 2 entries left removed, got %d", n)
+	}
+}
+
+func TestRankerSortModes(t *testing.T) {
+	now := time.Now()
+	r := NewRanker()
+	r.AddEntryBatch([]*entry.PathEntry{
+		{Path: entry.MakePath("/src/config"), Distance: 2, ModTime: now.Add(-time.Hour)},
+		{Path: entry.MakePath("/Beta/cfg"), Distance: 1, ModTime: now},
+		{Path: entry.MakePath("/archive/old/config"), Distance: 3},
+	})
+	r.SetQuery("config")
+
+	for _, tt := range []struct {
+		mode SortMode
+		want []string
+	}{
+		{SortScore, []string{"/src/config", "/archive/old/config"}},
+		{SortDistance, []string{"/src/config", "/archive/old/config"}},
+		{SortMTime, []string{"/src/config", "/archive/old/config"}},
+		{SortName, []string{"/archive/old/config", "/src/config"}},
+	} {
+		r.SetSort(tt.mode)
+		results := r.Results()
+		if len(results) != len(tt.want) {
+			t.Fatalf("%s: expected %v, got %+v", tt.mode, tt.want, results)
+		}
+		for i, want := range tt.want {
+			if results[i].Entry.AbsPath() != want {
+				t.Errorf("%s: result %d: expected %s, got %s", tt.mode, i, want, results[i].Entry.AbsPath())
+			}
+		}
+	}
+
+	// Without a query every entry matches, so the orders differ more
+	r.SetQuery("")
+	r.SetSort(SortMTime)
+	if got := r.Results()[0].Entry.AbsPath(); got != "/Beta/cfg" {
+		t.Errorf("expected the most recent entry first, got %s", got)
+	}
+	r.SetSort(SortName)
+	if got := r.Results()[0].Entry.AbsPath(); got != "/Beta/cfg" {
+		t.Errorf("expected names to sort case-insensitively, got %s", got)
+	}
+}
+
+func TestRankerTop(t *testing.T) {
+	now := time.Now()
+	rnd := rand.New(rand.NewSource(1))
+	r := NewRanker()
+	// Distinct distances and names, so every order is total
+	for _, d := range rnd.Perm(200) {
+		r.AddEntry(&entry.PathEntry{
+			Path:     entry.MakePath(fmt.Sprintf("/src/%c%d/config", 'a'+rnd.Intn(26), d)),
+			Distance: d,
+			ModTime:  now.Add(-time.Duration(rnd.Intn(50)) * time.Hour),
+		})
+	}
+	r.SetQuery("src")
+
+	for _, mode := range []SortMode{SortScore, SortDistance, SortMTime, SortName} {
+		r.SetSort(mode)
+		all := r.Results()
+		for _, n := range []int{0, 1, 10, 199, 200, 500} {
+			top := r.Top(n)
+			want := all[:min(n, len(all))]
+			if len(top) != len(want) {
+				t.Fatalf("%s: Top(%d) returned %d results, want %d", mode, n, len(top), len(want))
+			}
+			for i := range want {
+				if top[i].Entry != want[i].Entry {
+					t.Errorf("%s: Top(%d)[%d] = %s, want %s", mode, n, i, top[i].Entry.AbsPath(), want[i].Entry.AbsPath())
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestParseSortMode(t *testing.T) {
+	if mode, err := ParseSortMode("mtime"); err != nil || mode != SortMTime {
+		t.Errorf("expected %v, got %v, %v", SortMTime, mode, err)
+	}
+	if _, err := ParseSortMode("size"); !errors.Is(err, ErrInvalidSortMode) {
+		t.Errorf("expected %v, got %v", ErrInvalidSortMode, err)
+	}
+}
+
+func TestRankerRecency(t *testing.T) {
+	now := time.Now()
+	r := NewRanker()
+	r.AddEntryBatch([]*entry.PathEntry{
+		{Path: entry.MakePath("/old/app"), Distance: 2, ModTime: now.Add(-90 * 24 * time.Hour)},
+		{Path: entry.MakePath("/new/app"), Distance: 2, ModTime: now.Add(-time.Hour)},
+	})
+	r.SetQuery("app")
+	results := r.Results()
+	if results[0].Entry.AbsPath() != "/new/app" || results[0].Score <= results[1].Score {
+		t.Fatalf("expected the recently modified copy to score higher, got %+v", results)
+	}
+
+	// Without the signal, equal matches still prefer the recent one
+	w := DefaultWeights()
+	w.Recency = 0
+	r.SetWeights(w)
+	results = r.Results()
+	if results[0].Score != results[1].Score || results[0].Entry.AbsPath() != "/new/app" {
+		t.Errorf("expected equal scores broken by mtime, got %+v", results)
+	}
+}
+
+func TestWeightsBonusHalves(t *testing.T) {
+	now := time.Now()
+	w := Weights{Recency: 16, HalfLife: 24 * time.Hour}
+	for _, tt := range []struct {
+		age  time.Duration
+		want int
+	}{
+		{0, 16},
+		{24 * time.Hour, 8},
+		{48 * time.Hour, 4},
+	} {
+		e := &entry.PathEntry{ModTime: now.Add(-tt.age)}
+		if got := w.bonus(e, now); got != tt.want {
+			t.Errorf("bonus after %v = %d, want %d", tt.age, got, tt.want)
+		}
+	}
+	if got := w.bonus(&entry.PathEntry{}, now); got != 0 {
+		t.Errorf("expected no bonus for an unknown mtime, got %d", got)
+	}
+}
+
+func TestParseWeight(t *testing.T) {
+	w := DefaultWeights()
+	for _, s := range []string{"recency=32", "half-life=72h", "project = 0"} {
+		if err := w.ParseWeight(s); err != nil {
+			t.Fatalf("ParseWeight(%q): unexpected error: %v", s, err)
+		}
+	}
+	if w.Recency != 32 || w.HalfLife != 72*time.Hour || w.Project != 0 {
+		t.Errorf("unexpected weights %+v", w)
+	}
+	for _, s := range []string{"recency", "speed=1", "recency=high", "half-life=-1h"} {
+		if err := w.ParseWeight(s); !errors.Is(err, ErrInvalidWeight) {
+			t.Errorf("ParseWeight(%q): expected %v, got %v", s, ErrInvalidWeight, err)
+		}
+	}
+}
+
+func TestExplainAddsUp(t *testing.T) {
+	for _, tt := range []struct{ query, target string }{
+		{"cfg", "/home/me/.config/app"},
+		{"bil", "/work/billing/internal/testdata"},
+		{"proj", "/home/user/projects"},
+		{"abc", "/a/xbxc/abc"},
+		{"ss", "/srv/sites"},
+	} {
+		x := Explain(tt.query, tt.target)
+		_, want := score(tt.query, tt.target)
+		sum := x.Gaps
+		for _, c := range x.Chars {
+			sum += c.Match + c.Bonus + c.Consecutive + c.GapStart
+		}
+		if !x.Matched || x.Fuzzy != want || sum != want {
+			t.Errorf("Explain(%q, %q): fuzzy %d, parts sum to %d, want %d", tt.query, tt.target, x.Fuzzy, sum, want)
+		}
+		positions := x.Positions()
+		runes := []rune(tt.target)
+		for i, p := range positions {
+			if i > 0 && p <= positions[i-1] {
+				t.Errorf("Explain(%q, %q): positions %v not increasing", tt.query, tt.target, positions)
+			}
+			if !strings.EqualFold(string(runes[p]), string([]rune(tt.query)[i])) {
+				t.Errorf("Explain(%q, %q): position %d is %q", tt.query, tt.target, p, runes[p])
+			}
+		}
+	}
+
+	if x := Explain("zzz", "/home"); x.Matched {
+		t.Errorf("expected no match, got %+v", x)
+	}
+	if got := Explain("bil", "/work/billing").Highlight("[", "]"); got != "/work/[bil]ling" {
+		t.Errorf("unexpected highlight %q", got)
+	}
+}
+
+func TestRankerExplainMatchesScore(t *testing.T) {
+	e := &entry.PathEntry{Path: entry.MakePath("/work/billing"), Distance: 1, Project: "go", ModTime: time.Now()}
+	r := NewRankerWithBias(func(*entry.PathEntry) int { return 5 })
+	r.AddEntry(e)
+	r.SetQuery("bil")
+	x := r.Explain("bil", e)
+	if got := r.Results()[0].Score; x.Score != got {
+		t.Errorf("explained score %d, ranked score %d (%+v)", x.Score, got, x)
+	}
+	if x.Bias != 5 || x.Project != DefaultWeights().Project || x.Kind != "go" || x.Recency == 0 {
+		t.Errorf("unexpected signals %+v", x)
+	}
+}
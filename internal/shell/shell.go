@@ -0,0 +1,57 @@
+// Package shell renders the shell integration code printed by
+// `bcd-bin init`. The scripts are embedded templates, so the functions a
+// shell loads always match the binary that generated them.
+package shell
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"text/template"
+)
+
+//go:embed *.tmpl
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "*.tmpl"))
+
+// Shells lists the supported shells in the order they are documented.
+var Shells = []string{"bash", "zsh", "fish"}
+
+var ErrInvalidCmd = errors.New("invalid function name")
+
+// validCmd matches names that are valid functions in every supported shell.
+var validCmd = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+type Options struct {
+	// Cmd is the name of the function that wraps bcd-bin.
+	Cmd string
+	// Hook installs a directory change hook that records every visited
+	// directory in the frecency history.
+	Hook bool
+	// Keybind binds the path picker widget to Ctrl-G. The widget itself is
+	// always defined so users can bind it elsewhere.
+	Keybind bool
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Cmd:     "bcd",
+		Hook:    false,
+		Keybind: true,
+	}
+}
+
+// Render writes the integration code for shell to w.
+func Render(w io.Writer, shell string, opts Options) error {
+	if !validCmd.MatchString(opts.Cmd) {
+		return fmt.Errorf("%w: %q", ErrInvalidCmd, opts.Cmd)
+	}
+	t := templates.Lookup("bcd." + shell + ".tmpl")
+	if t == nil {
+		return fmt.Errorf("unsupported shell %q (supported: bash, zsh, fish)", shell)
+	}
+	return t.Execute(w, opts)
+}
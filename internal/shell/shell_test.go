@@ -0,0 +1,66 @@
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestRenderGolden(t *testing.T) {
+	variants := []struct {
+		name string
+		opts Options
+	}{
+		{"default", DefaultOptions()},
+		{"custom", Options{Cmd: "j", Hook: true, Keybind: false}},
+	}
+
+	for _, shell := range Shells {
+		for _, v := range variants {
+			name := shell + "_" + v.name
+			t.Run(name, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := Render(&buf, shell, v.opts); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				golden := filepath.Join("testdata", name+".golden")
+				if *update {
+					if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("reading golden file (run with -update to create it): %v", err)
+				}
+				if !bytes.Equal(buf.Bytes(), want) {
+					t.Errorf("output differs from %s (run with -update to accept)\n got:\n%s\nwant:\n%s",
+						golden, buf.String(), want)
+				}
+			})
+		}
+	}
+}
+
+func TestRenderUnsupportedShell(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, "tcsh", DefaultOptions()); err == nil {
+		t.Error("expected error for unsupported shell")
+	}
+}
+
+func TestRenderInvalidCmd(t *testing.T) {
+	for _, cmd := range []string{"", "1bcd", "b cd", "bcd;rm"} {
+		var buf bytes.Buffer
+		err := Render(&buf, "bash", Options{Cmd: cmd})
+		if !errors.Is(err, ErrInvalidCmd) {
+			t.Errorf("Render with cmd %q: expected %v, got %v", cmd, ErrInvalidCmd, err)
+		}
+	}
+}
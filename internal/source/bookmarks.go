@@ -0,0 +1,43 @@
+package source
+
+import (
+	"context"
+
+	"github.com/sakolb/bcd/internal/bookmark"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// Bookmarks streams bookmarked paths, nearest first when there is no query.
+type Bookmarks struct {
+	file    string
+	baseDir string
+}
+
+func NewBookmarks(file string, baseDir string) *Bookmarks {
+	return &Bookmarks{file: file, baseDir: baseDir}
+}
+
+func (b *Bookmarks) Name() string { return NameBookmarks }
+
+func (b *Bookmarks) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	bookmarks, err := bookmark.Load(b.file)
+	if err != nil {
+		return
+	}
+	for _, bm := range bookmarks {
+		e, err := entry.NewPathEntry(bm.Path, b.baseDir)
+		if err != nil {
+			continue
+		}
+		e.Origin = originBookmarks
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+func (b *Bookmarks) NewRanker() *ranker.Ranker {
+	return ranker.NewRanker()
+}
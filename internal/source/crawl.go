@@ -0,0 +1,314 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakolb/bcd/internal/archive"
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/daemon"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// maxFailures bounds how many failed paths a crawl remembers; the crawler's
+// counters still cover the rest.
+const maxFailures = 1000
+
+// Crawl streams entries from a live BFS crawl of a base directory, ranked
+// by fuzzy score and distance. With a daemon, the entries come from its
+// index instead, when it has indexed the base directory.
+type Crawl struct {
+	baseDir string
+	opts    crawler.Options
+	daemon  *daemon.Client
+	// watch follows the changes below the crawled directories once the
+	// crawl is done
+	watch bool
+
+	mu       sync.Mutex
+	crawler  *crawler.Crawler
+	remote   *remoteStats
+	failures []Failure
+	// dirs are the directories crawled nearest the base, to be watched
+	// by follower
+	dirs     []string
+	follower *follower
+}
+
+// remoteStats counts the entries received from the daemon.
+type remoteStats struct {
+	started  time.Time
+	finished time.Time
+	dirs     int64
+	files    int64
+	errors   int64
+}
+
+// NewCrawl crawls baseDir with opts. Errors are always collected, as
+// failures, whatever opts.IgnoreErrors says.
+func NewCrawl(baseDir string, opts crawler.Options) *Crawl {
+	opts.IgnoreErrors = false
+	return &Crawl{baseDir: baseDir, opts: opts}
+}
+
+// UseDaemon asks the daemon behind client for the entries first, crawling
+// only if it is not running, has not indexed the base directory, or
+// archives are to be crawled.
+func (c *Crawl) UseDaemon(client *daemon.Client) {
+	c.daemon = client
+}
+
+// WatchChanges makes Watch follow the entries created, removed and renamed
+// below the crawled directories. Every directory is then crawled whatever
+// the types asked for, so that they are known.
+func (c *Crawl) WatchChanges() {
+	c.watch = true
+}
+
+func (c *Crawl) Name() string { return NameCrawl }
+
+func (c *Crawl) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	// Before out is closed, so that Watch misses nothing made after
+	defer c.startWatching(ctx)
+	c.mu.Lock()
+	c.dirs = nil
+	c.mu.Unlock()
+	// The daemon's index does not look inside archives
+	root := ""
+	if c.daemon != nil && !c.opts.Archives {
+		var ok bool
+		root, ok = c.fromDaemon(ctx, out)
+		if ok && (root == "" || ctx.Err() != nil) {
+			return
+		}
+	}
+
+	cr := crawler.NewCrawlerWithOptions(c.crawlOptions())
+	c.mu.Lock()
+	c.crawler = cr
+	if root == "" {
+		c.remote = nil
+		c.failures = nil
+	}
+	c.mu.Unlock()
+
+	// Above the daemon's root, the crawl goes on by itself
+	if root != "" {
+		go cr.CrawlAbove(root)
+	} else {
+		go cr.Crawl(c.baseDir)
+	}
+	go c.collectFailures(cr)
+	// Stop the crawl when the picker moves on, rather than leaving it
+	// blocked on a channel nobody reads
+	defer cr.Stop()
+
+	for p := range cr.Paths() {
+		e, ok := c.found(p)
+		if ok && !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+// crawlOptions returns the options of the crawl itself, which include
+// every type when the directories are to be watched.
+func (c *Crawl) crawlOptions() crawler.Options {
+	opts := c.opts
+	if c.watch {
+		opts.Types = nil
+	}
+	return opts
+}
+
+// wanted reports whether entries of type t were asked for.
+func (c *Crawl) wanted(t entry.FileType) bool {
+	return len(c.opts.Types) == 0 || slices.Contains(c.opts.Types, t)
+}
+
+// found remembers the directories to watch among the paths found, and
+// returns the entry of p when its type was asked for.
+func (c *Crawl) found(p crawler.Path) (*entry.PathEntry, bool) {
+	if c.watch && p.Type == entry.FileTypeDir && !archive.Inside(p.Path) {
+		c.mu.Lock()
+		if len(c.dirs) < maxWatches {
+			c.dirs = append(c.dirs, p.Path)
+		}
+		c.mu.Unlock()
+	}
+	if !c.wanted(p.Type) {
+		return nil, false
+	}
+	e, err := c.entry(p)
+	return e, err == nil
+}
+
+// fromDaemon sends the entries of the daemon's index, and returns the root
+// the daemon stopped at, "" if the crawl was cut short. It reports false,
+// having sent nothing, when the daemon could not answer.
+func (c *Crawl) fromDaemon(ctx context.Context, out chan<- *entry.PathEntry) (string, bool) {
+	stats := &remoteStats{started: time.Now()}
+	c.mu.Lock()
+	c.crawler = nil
+	c.remote = stats
+	c.failures = nil
+	c.mu.Unlock()
+
+	received := false
+	root, err := c.daemon.Crawl(ctx, c.baseDir, c.crawlOptions(), func(p crawler.Path) bool {
+		received = true
+		c.mu.Lock()
+		if p.Type == entry.FileTypeDir {
+			stats.dirs++
+		} else {
+			stats.files++
+		}
+		c.mu.Unlock()
+		e, ok := c.found(p)
+		return !ok || send(ctx, out, e)
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !received && ctx.Err() == nil {
+		c.remote = nil
+		return "", false
+	}
+	stats.finished = time.Now()
+	if err != nil && ctx.Err() == nil {
+		stats.errors++
+		c.failures = append(c.failures, Failure{Path: c.daemon.Socket(), Err: err})
+	}
+	return root, true
+}
+
+// entry builds the entry of a path found by the crawl.
+func (c *Crawl) entry(p crawler.Path) (*entry.PathEntry, error) {
+	e, err := entry.NewPathEntryWithType(p.Path, c.baseDir, p.Type)
+	if err != nil {
+		return nil, err
+	}
+	e.Origin = originCrawl
+	e.Project = p.Project
+	e.ModTime = p.ModTime
+	return e, nil
+}
+
+func (c *Crawl) NewRanker() *ranker.Ranker {
+	return ranker.NewRanker()
+}
+
+// collectFailures drains the crawler's errors, remembering the paths that
+// could not be read.
+func (c *Crawl) collectFailures(cr *crawler.Crawler) {
+	for err := range cr.Errors() {
+		f := Failure{Err: err}
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			f.Path = pathErr.Path
+			f.Err = pathErr.Err
+		}
+		c.mu.Lock()
+		if len(c.failures) < maxFailures {
+			c.failures = append(c.failures, f)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Crawl) Stats() crawler.Stats {
+	c.mu.Lock()
+	cr := c.crawler
+	if c.remote == nil {
+		c.mu.Unlock()
+		if cr == nil {
+			return crawler.Stats{}
+		}
+		return cr.Stats()
+	}
+	r := *c.remote
+	c.mu.Unlock()
+
+	s := crawler.Stats{Dirs: r.dirs, Files: r.files, Errors: r.errors}
+	end := time.Now()
+	if !r.finished.IsZero() {
+		end = r.finished
+		s.Done = true
+	}
+	s.Elapsed = end.Sub(r.started)
+	if cr != nil {
+		// The daemon has answered, and the crawl goes on above its root
+		above := cr.Stats()
+		s.Dirs += above.Dirs
+		s.Files += above.Files
+		s.Depth = above.Depth
+		s.PermissionDenied = above.PermissionDenied
+		s.Errors += above.Errors
+		s.Elapsed += above.Elapsed
+		s.Done = above.Done
+	}
+	return s
+}
+
+func (c *Crawl) Failures() []Failure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Failure(nil), c.failures...)
+}
+
+// Reader streams newline separated paths from a reader such as stdin.
+// Relative paths are resolved against the base directory. Paths that do
+// not exist are still accepted (as directories) so that candidate lists
+// can be ranked without a matching tree on disk.
+type Reader struct {
+	name    string
+	baseDir string
+	r       io.Reader
+}
+
+func NewReader(name string, baseDir string, r io.Reader) *Reader {
+	return &Reader{name: name, baseDir: baseDir, r: r}
+}
+
+func (s *Reader) Name() string { return s.name }
+
+func (s *Reader) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	origin := entry.OriginOf(s.name)
+	scanner := bufio.NewScanner(s.r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		path := line
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.baseDir, path)
+		}
+		e, err := entry.NewPathEntry(path, s.baseDir)
+		if errors.Is(err, fs.ErrNotExist) {
+			e, err = entry.NewPathEntryWithType(path, s.baseDir, entry.FileTypeDir)
+		}
+		if err != nil {
+			continue
+		}
+		e.Origin = origin
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+func (s *Reader) NewRanker() *ranker.Ranker {
+	return ranker.NewRanker()
+}
@@ -0,0 +1,89 @@
+package source
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/history"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// frecencyWeight scales the log of an entry's frecency into score points,
+// so frequent directories win close fuzzy matches without drowning out a
+// clearly better match.
+const frecencyWeight = 8
+
+// History streams directories from the frecency history, most frecent
+// first, and ranks them by frecency as well as by fuzzy score.
+type History struct {
+	file    string
+	baseDir string
+	now     time.Time
+	bias    map[entry.Path]int
+}
+
+func NewHistory(file string, baseDir string) *History {
+	return &History{
+		file:    file,
+		baseDir: baseDir,
+		now:     time.Now(),
+		bias:    make(map[entry.Path]int),
+	}
+}
+
+func (h *History) Name() string { return NameHistory }
+
+func (h *History) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	visits, err := history.Load(h.file)
+	if err != nil {
+		return
+	}
+
+	entries := make([]*entry.PathEntry, 0, len(visits))
+	for _, v := range visits {
+		// Directories that were removed since the visit are skipped
+		e, err := entry.NewPathEntry(v.Path, h.baseDir)
+		if err != nil {
+			continue
+		}
+		e.Origin = originHistory
+		h.bias[e.Path] = frecencyBias(v, h.now)
+		entries = append(entries, e)
+	}
+
+	// The bias map is complete before the first entry reaches the ranker
+	for _, e := range entries {
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+// frecencyBias turns a visit's frecency into score points.
+func frecencyBias(v history.Entry, now time.Time) int {
+	return int(math.Log2(1+v.Frecency(now)) * frecencyWeight)
+}
+
+// FrecencyBias returns the bias the history tab gives each directory in
+// file, for ranking paths outside the picker. A missing or unreadable
+// history adds nothing.
+func FrecencyBias(file string) ranker.BiasFunc {
+	visits, _ := history.Load(file)
+	now := time.Now()
+	bias := make(map[entry.Path]int, len(visits))
+	for _, v := range visits {
+		bias[entry.MakePath(v.Path)] = frecencyBias(v, now)
+	}
+	return func(e *entry.PathEntry) int {
+		return bias[e.Path]
+	}
+}
+
+func (h *History) NewRanker() *ranker.Ranker {
+	return ranker.NewRankerWithBias(func(e *entry.PathEntry) int {
+		return h.bias[e.Path]
+	})
+}
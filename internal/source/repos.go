@@ -0,0 +1,84 @@
+package source
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/sakolb/bcd/internal/bookmark"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/gitinfo"
+	"github.com/sakolb/bcd/internal/history"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// Repos streams the repositories bcd already knows about: the one
+// containing the base directory, and those that are visited directories
+// or bookmarks (or contain them).
+type Repos struct {
+	baseDir       string
+	historyFile   string
+	bookmarksFile string
+}
+
+func NewRepos(baseDir string, historyFile string, bookmarksFile string) *Repos {
+	return &Repos{
+		baseDir:       baseDir,
+		historyFile:   historyFile,
+		bookmarksFile: bookmarksFile,
+	}
+}
+
+func (r *Repos) Name() string { return NameRepos }
+
+func (r *Repos) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+
+	candidates := []string{r.baseDir}
+	if visits, err := history.Load(r.historyFile); err == nil {
+		for _, v := range visits {
+			candidates = append(candidates, v.Path)
+		}
+	}
+	if bookmarks, err := bookmark.Load(r.bookmarksFile); err == nil {
+		for _, b := range bookmarks {
+			candidates = append(candidates, b.Path)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		root, ok := RepoRoot(path)
+		if !ok || seen[root] {
+			continue
+		}
+		seen[root] = true
+		e, err := entry.NewPathEntry(root, r.baseDir)
+		if err != nil {
+			continue
+		}
+		e.Origin = originRepos
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+func (r *Repos) NewRanker() *ranker.Ranker {
+	return ranker.NewRanker()
+}
+
+// RepoRoot returns the nearest directory at or above path that contains a
+// .git entry.
+func RepoRoot(path string) (string, bool) {
+	dir := filepath.Clean(path)
+	for {
+		if gitinfo.IsRepoRoot(dir) {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
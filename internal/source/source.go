@@ -0,0 +1,238 @@
+// Package source defines where the picker's entries come from. Each
+// Source streams entries tagged with its name and supplies the ranker that
+// orders them, so the TUI can show the live crawl, frecency history,
+// bookmarks and known repositories side by side.
+package source
+
+import (
+	"context"
+
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// Names of the built-in sources, used as tab titles and result tags.
+const (
+	NameCrawl     = "crawl"
+	NameStdin     = "stdin"
+	NameHistory   = "history"
+	NameBookmarks = "bookmarks"
+	NameRepos     = "repos"
+)
+
+// Origins of the built-in sources, to tag entries with.
+var (
+	originCrawl     = entry.OriginOf(NameCrawl)
+	originHistory   = entry.OriginOf(NameHistory)
+	originBookmarks = entry.OriginOf(NameBookmarks)
+	originRepos     = entry.OriginOf(NameRepos)
+)
+
+type Source interface {
+	// Name is the label shown in the tab bar and next to each result.
+	Name() string
+	// Entries sends the source's entries on out, each with Origin set to
+	// Name, and closes out when the source is exhausted or ctx is done.
+	Entries(ctx context.Context, out chan<- *entry.PathEntry)
+	// NewRanker returns an empty ranker that orders this source's entries.
+	NewRanker() *ranker.Ranker
+}
+
+// Failure is a path a source could not read.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// StatsReporter is implemented by sources that report their progress
+// while running, such as the crawl.
+type StatsReporter interface {
+	Stats() crawler.Stats
+	// Failures returns the paths that could not be read so far.
+	Failures() []Failure
+}
+
+// Change is an update to a source's entries after they were all sent: an
+// entry added, a path removed, or a path renamed.
+type Change struct {
+	// From is the path removed or renamed, with everything below it
+	From string
+	// To is the new path of a renamed entry
+	To string
+	// Entry is the entry added, or the renamed entry at its new path
+	Entry *entry.PathEntry
+}
+
+// Live is implemented by sources that keep their entries up to date once
+// Entries is done, such as the crawl.
+type Live interface {
+	// Watch sends the changes to the source's entries on out, from when
+	// Entries closed its channel, and closes out when ctx is done or the
+	// source stops following them.
+	Watch(ctx context.Context, out chan<- Change)
+}
+
+// send delivers e on out unless ctx is done first.
+func send(ctx context.Context, out chan<- *entry.PathEntry, e *entry.PathEntry) bool {
+	select {
+	case out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Static is a source over entries that are already known, such as
+// candidates collected before the picker started.
+type Static struct {
+	name    string
+	entries []*entry.PathEntry
+}
+
+func NewStatic(name string, entries []*entry.PathEntry) *Static {
+	return &Static{name: name, entries: entries}
+}
+
+func (s *Static) Name() string { return s.name }
+
+func (s *Static) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	origin := entry.OriginOf(s.name)
+	for _, e := range s.entries {
+		e.Origin = origin
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+func (s *Static) NewRanker() *ranker.Ranker {
+	return ranker.NewRanker()
+}
+
+// Resumed is a source whose entries were already being read: it sends
+// those read so far, then the rest as they come. It is Live when the
+// source it resumes is.
+type Resumed struct {
+	Source
+	read []*entry.PathEntry
+	rest <-chan *entry.PathEntry
+}
+
+// NewResumed resumes src, read entries of which were received from rest.
+func NewResumed(src Source, read []*entry.PathEntry, rest <-chan *entry.PathEntry) *Resumed {
+	return &Resumed{Source: src, read: read, rest: rest}
+}
+
+func (r *Resumed) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	for _, e := range r.read {
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+	for e := range r.rest {
+		if !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+// Watch passes on the changes of the resumed source, when it is Live.
+func (r *Resumed) Watch(ctx context.Context, out chan<- Change) {
+	live, ok := r.Source.(Live)
+	if !ok {
+		close(out)
+		return
+	}
+	live.Watch(ctx, out)
+}
+
+// Unwrap returns the resumed source.
+func (r *Resumed) Unwrap() Source {
+	return r.Source
+}
+
+// Filtered passes on the entries of another source that keep accepts.
+type Filtered struct {
+	Source
+	keep func(e *entry.PathEntry) bool
+}
+
+func NewFiltered(src Source, keep func(e *entry.PathEntry) bool) *Filtered {
+	return &Filtered{Source: src, keep: keep}
+}
+
+func (f *Filtered) Entries(ctx context.Context, out chan<- *entry.PathEntry) {
+	defer close(out)
+	in := make(chan *entry.PathEntry, 1000)
+	go f.Source.Entries(ctx, in)
+	for e := range in {
+		if f.keep(e) && !send(ctx, out, e) {
+			return
+		}
+	}
+}
+
+// Watch passes on the changes of the filtered source, when it is Live,
+// dropping the added entries that keep rejects.
+func (f *Filtered) Watch(ctx context.Context, out chan<- Change) {
+	defer close(out)
+	live, ok := f.Source.(Live)
+	if !ok {
+		return
+	}
+	in := make(chan Change, 100)
+	go live.Watch(ctx, in)
+	for c := range in {
+		if c.From == "" && !f.keep(c.Entry) {
+			continue
+		}
+		select {
+		case out <- c:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Unwrap returns the filtered source.
+func (f *Filtered) Unwrap() Source {
+	return f.Source
+}
+
+// IsRepo keeps the roots of git repositories. It reads their git metadata
+// while filtering, so it is ready to display.
+func IsRepo(e *entry.PathEntry) bool {
+	_, ok := e.Git()
+	return ok
+}
+
+// IsProject keeps project roots, as recognized by the crawl.
+func IsProject(e *entry.PathEntry) bool {
+	return e.Project != ""
+}
+
+// DetectProject returns a filter keeping project roots, recognized by
+// reading each directory, for sources that don't recognize them
+// themselves.
+func DetectProject(markers []project.Marker) func(e *entry.PathEntry) bool {
+	m := project.NewMatcher(markers)
+	return func(e *entry.PathEntry) bool {
+		if e.Project == "" && e.FType == entry.FileTypeDir && m != nil {
+			e.Project, _ = m.Detect(e.AbsPath())
+		}
+		return e.Project != ""
+	}
+}
+
+// LoadMetadata keeps every entry, loading its metadata on the way, for
+// entries shown with their mtime, size, mode and owner.
+func LoadMetadata(e *entry.PathEntry) bool {
+	if e.Meta == nil {
+		e.LoadMetadata()
+	}
+	return true
+}
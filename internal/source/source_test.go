@@ -0,0 +1,360 @@
+package source
+
+import (
+	"archive/zip"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/daemon"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/history"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/vfs"
+)
+
+func collect(t *testing.T, src Source) []*entry.PathEntry {
+	t.Helper()
+	out := make(chan *entry.PathEntry)
+	go src.Entries(context.Background(), out)
+	var entries []*entry.PathEntry
+	for e := range out {
+		if e.Origin.String() != src.Name() {
+			t.Errorf("expected origin %q, got %q", src.Name(), e.Origin)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestReaderResolvesRelativePaths(t *testing.T) {
+	input := "a/cfg\n\n/etc/config\r\nmissing/dir\n"
+	entries := collect(t, NewReader(NameStdin, "/base", strings.NewReader(input)))
+
+	want := []string{"/base/a/cfg", "/etc/config", "/base/missing/dir"}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(entries))
+	}
+	for i, e := range entries {
+		if e.AbsPath() != want[i] {
+			t.Errorf("entry %d: expected %s, got %s", i, want[i], e.AbsPath())
+		}
+	}
+}
+
+func TestStaticStopsOnCancel(t *testing.T) {
+	entries := []*entry.PathEntry{{Path: entry.MakePath("/a")}, {Path: entry.MakePath("/b")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := make(chan *entry.PathEntry)
+	done := make(chan struct{})
+	go func() {
+		NewStatic("static", entries).Entries(ctx, out)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Entries did not return after cancellation")
+	}
+}
+
+func TestResumedSendsReadEntriesFirst(t *testing.T) {
+	src := NewReader(NameStdin, "/base", strings.NewReader("a\nb\nc\n"))
+	rest := make(chan *entry.PathEntry)
+	go src.Entries(context.Background(), rest)
+	read := []*entry.PathEntry{<-rest}
+
+	var got []string
+	for _, e := range collect(t, NewResumed(src, read, rest)) {
+		got = append(got, e.AbsPath())
+	}
+	if want := []string{"/base/a", "/base/b", "/base/c"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHistoryRanksByFrecency(t *testing.T) {
+	base := t.TempDir()
+	often := filepath.Join(base, "often")
+	rarely := filepath.Join(base, "rarely")
+	for _, dir := range []string{often, rarely} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "history.json")
+	now := time.Now()
+	for _, dir := range []string{rarely, often, often, often} {
+		if err := history.Add(file, dir, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := NewHistory(file, base)
+	r := src.NewRanker()
+	r.AddEntryBatch(collect(t, src))
+
+	results := r.Results()
+	if len(results) != 2 || results[0].Entry.AbsPath() != often {
+		t.Fatalf("expected %s first, got %+v", often, results)
+	}
+}
+
+func TestRepoRoot(t *testing.T) {
+	repo := t.TempDir()
+	nested := filepath.Join(repo, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	root, ok := RepoRoot(nested)
+	if !ok || root != repo {
+		t.Errorf("expected %s, got %s (found=%v)", repo, root, ok)
+	}
+}
+
+func TestFilteredDetectsProjects(t *testing.T) {
+	base := t.TempDir()
+	for _, dir := range []string{"billing/internal/testdata", "docs"} {
+		if err := os.MkdirAll(filepath.Join(base, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(base, "billing", "go.mod"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "billing\nbilling/internal/testdata\ndocs\n"
+	src := NewFiltered(NewReader(NameStdin, base, strings.NewReader(input)), DetectProject(project.DefaultMarkers))
+	entries := collect(t, src)
+	if len(entries) != 1 || entries[0].AbsPath() != filepath.Join(base, "billing") || entries[0].Project != "go" {
+		t.Fatalf("expected only billing as a go project, got %v", entries)
+	}
+}
+
+func TestFrecencyBias(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.json")
+	if err := history.Add(file, "/visited", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	bias := FrecencyBias(file)
+	if bias(&entry.PathEntry{Path: entry.MakePath("/visited")}) <= 0 {
+		t.Error("expected a visited directory to get a bias")
+	}
+	if got := bias(&entry.PathEntry{Path: entry.MakePath("/other")}); got != 0 {
+		t.Errorf("expected no bias for an unvisited directory, got %d", got)
+	}
+}
+
+// serveIndex serves an index of root from a daemon until the test ends,
+// and returns a client of it.
+func serveIndex(t *testing.T, root string) *daemon.Client {
+	t.Helper()
+	index := daemon.NewIndex(nil, func(err error) { t.Log(err) })
+	t.Cleanup(func() { index.Close() })
+	if err := index.AddRoot(root); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	ln, err := daemon.Listen(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go daemon.NewServer(index).Serve(ctx, ln)
+	return daemon.NewClient(socket)
+}
+
+func TestCrawlUsesDaemon(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The daemon answers for what it indexed, the root and below, and the
+	// crawl goes on by itself above it, up to the root's grandparent here
+	src := NewCrawl(root, crawler.Options{})
+	src.UseDaemon(serveIndex(t, root))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *entry.PathEntry)
+	go src.Entries(ctx, out)
+	var paths []string
+	for e := range out {
+		if e.AbsPath() == filepath.Dir(filepath.Dir(root)) {
+			break
+		}
+		paths = append(paths, e.AbsPath())
+	}
+	want := []string{root, filepath.Join(root, "a"), filepath.Join(root, "a", "b"), filepath.Dir(root)}
+	if len(paths) < len(want) || !slices.Equal(paths[:len(want)], want) {
+		t.Fatalf("got %q, want %q first", paths, want)
+	}
+	for _, path := range paths[len(want):] {
+		if path == root || strings.HasPrefix(path, root+"/") {
+			t.Errorf("%s was sent twice", path)
+		}
+	}
+	if s := src.Stats(); s.Dirs < 4 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCrawlFallsBackWithoutDaemon(t *testing.T) {
+	root := t.TempDir()
+	src := NewCrawl(root, crawler.Options{})
+	src.UseDaemon(daemon.NewClient(filepath.Join(t.TempDir(), "daemon.sock")))
+
+	// Crawling by itself, it goes on above the root
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *entry.PathEntry)
+	go src.Entries(ctx, out)
+	for e := range out {
+		if e.AbsPath() == filepath.Dir(root) {
+			return
+		}
+	}
+	t.Error("the crawl never reached the root's parent")
+}
+
+func TestCrawlArchives(t *testing.T) {
+	root := t.TempDir()
+	f, err := os.Create(filepath.Join(root, "bundle.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"app/go.mod", "app/logs/today.log", "node_modules/x.js"} {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zw.Close()
+	f.Close()
+
+	// Archives are not in the daemon's index, so it is not asked
+	src := NewCrawl(root, crawler.Options{Archives: true, Markers: project.DefaultMarkers, Ignore: []string{"node_modules"}})
+	src.UseDaemon(serveIndex(t, root))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan *entry.PathEntry)
+	go src.Entries(ctx, out)
+	var paths []string
+	projects := make(map[string]string)
+	for e := range out {
+		// Past the root, as crawling by itself
+		if e.AbsPath() == filepath.Dir(root) {
+			break
+		}
+		paths = append(paths, strings.TrimPrefix(e.AbsPath(), root))
+		projects[e.AbsPath()] = e.Project
+	}
+	want := []string{"", "/bundle.zip", "/bundle.zip!", "/bundle.zip!/app", "/bundle.zip!/app/go.mod", "/bundle.zip!/app/logs", "/bundle.zip!/app/logs/today.log"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("got %q, want %q", paths, want)
+	}
+	if got := projects[root+"/bundle.zip!/app"]; got != "go" {
+		t.Errorf("expected the archived app to be a go project, got %q", got)
+	}
+}
+
+func TestCrawlWatchesChanges(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Served by a daemon, and crawled above the root without reading
+	// anything, so that only the root is followed
+	unreadable := &vfs.Faulty{FS: vfs.OS, Fault: func(op string, name string) error {
+		return fs.ErrPermission
+	}}
+	src := NewCrawl(root, crawler.Options{Types: []entry.FileType{entry.FileTypeDir}, Ignore: []string{"*.tmp"}, FS: unreadable})
+	src.UseDaemon(serveIndex(t, root))
+	src.WatchChanges()
+	below := 0
+	for _, e := range collect(t, src) {
+		if e.AbsPath() == root || strings.HasPrefix(e.AbsPath(), root+"/") {
+			below++
+		}
+	}
+	if below != 2 {
+		t.Fatalf("expected the 2 directories, got %d", below)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan Change)
+	go src.Watch(ctx, changes)
+	// Changes above the root are left out
+	next := func() Change {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case c := <-changes:
+				path := c.From
+				if path == "" {
+					path = c.Entry.AbsPath()
+				}
+				if strings.HasPrefix(path, root+"/") {
+					return c
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for a change")
+				return Change{}
+			}
+		}
+	}
+	rel := func(path string) string {
+		r, _ := filepath.Rel(root, path)
+		return r
+	}
+
+	// Created at once: the new directories are each sent once, and the
+	// files and ignored directories not at all
+	if err := os.MkdirAll(filepath.Join(root, "build", "out", "x.tmp"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "build", "out", "main.o"), nil, 0o644)
+	for _, want := range []string{"build", "build/out"} {
+		if c := next(); c.From != "" || rel(c.Entry.AbsPath()) != want || c.Entry.FType != entry.FileTypeDir {
+			t.Fatalf("expected %s added, got %+v", want, c)
+		}
+	}
+
+	if err := os.Rename(filepath.Join(root, "build"), filepath.Join(root, "dist")); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); rel(c.From) != "build" || rel(c.To) != "dist" || c.Entry.AbsPath() != c.To {
+		t.Fatalf("expected build renamed to dist, got %+v", c)
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "dist")); err != nil {
+		t.Fatal(err)
+	}
+	// The ignored directory and the file are not reported either
+	for _, want := range []string{"dist/out", "dist"} {
+		if c := next(); rel(c.From) != want || c.To != "" {
+			t.Fatalf("expected %s removed, got %+v", want, c)
+		}
+	}
+
+	cancel()
+	for range changes {
+	}
+}
@@ -0,0 +1,302 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sakolb/bcd/internal/archive"
+	"github.com/sakolb/bcd/internal/crawler"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/project"
+	"github.com/sakolb/bcd/internal/watch"
+)
+
+// maxWatches bounds how many directories a crawl watches, the nearest to
+// the base first: inotify watches are shared by every program of the user,
+// and the crawl goes on to the whole filesystem.
+const maxWatches = 8192
+
+// errMissed is the failure reported when inotify dropped events.
+var errMissed = errors.New("too many changes at once, some were missed")
+
+// startWatching watches the directories crawled, once WatchChanges was
+// called, for Watch to follow their changes until ctx is done.
+func (c *Crawl) startWatching(ctx context.Context) {
+	c.mu.Lock()
+	dirs := c.dirs
+	c.dirs = nil
+	c.mu.Unlock()
+	if !c.watch || len(dirs) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	w, err := watch.New()
+	if err != nil {
+		c.fail(Failure{Err: err})
+		return
+	}
+	context.AfterFunc(ctx, func() { w.Close() })
+	f := &follower{
+		crawl:   c,
+		w:       w,
+		markers: project.NewMatcher(c.opts.Markers),
+		added:   make(map[string]bool),
+	}
+	for _, dir := range dirs {
+		if !f.watch(dir) {
+			break
+		}
+	}
+	c.mu.Lock()
+	c.follower = f
+	c.mu.Unlock()
+}
+
+// Watch follows the changes below the directories crawled, once WatchChanges
+// was called: the entries created, removed and renamed since Entries was
+// done. Changes made while the crawl ran are missed.
+func (c *Crawl) Watch(ctx context.Context, out chan<- Change) {
+	defer close(out)
+	c.mu.Lock()
+	f := c.follower
+	c.follower = nil
+	c.mu.Unlock()
+	if f == nil {
+		return
+	}
+	f.ctx = ctx
+	f.out = out
+
+	for {
+		select {
+		case ev, ok := <-f.w.Events():
+			if !ok {
+				return
+			}
+			if !f.apply(ev) {
+				return
+			}
+		case err := <-f.w.Errors():
+			c.fail(Failure{Err: err})
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fail remembers f, within the bound on failures.
+func (c *Crawl) fail(f Failure) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failures) < maxFailures {
+		c.failures = append(c.failures, f)
+	}
+}
+
+// follower turns a crawl's inotify events into changes.
+type follower struct {
+	crawl   *Crawl
+	w       *watch.Watcher
+	ctx     context.Context
+	out     chan<- Change
+	markers *project.Matcher
+	// added holds the paths sent since the crawl, as a new directory is
+	// read while the events about its entries may still come
+	added map[string]bool
+	full  bool
+}
+
+// watch starts watching dir unless the watches ran out, and reports
+// whether more can be.
+func (f *follower) watch(dir string) bool {
+	if f.full || f.w.Len() >= maxWatches {
+		return false
+	}
+	err := f.w.Add(dir)
+	if errors.Is(err, watch.ErrNoSpace) {
+		f.full = true
+		f.crawl.fail(Failure{Path: dir, Err: watch.ErrNoSpace})
+		return false
+	}
+	// Directories gone or unreadable since the crawl are not reported
+	// again
+	return err == nil || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
+// apply sends the changes ev stands for, and reports whether to go on.
+func (f *follower) apply(ev watch.Event) bool {
+	switch ev.Op {
+	case watch.Create:
+		return f.create(ev.Path)
+	case watch.Remove:
+		if !f.known(ev.Path, ev.Dir) {
+			return true
+		}
+		return f.remove(ev.Path)
+	case watch.Rename:
+		switch {
+		case !f.known(ev.OldPath, ev.Dir):
+			return f.create(ev.Path)
+		case f.ignored(ev.Path):
+			return f.remove(ev.OldPath)
+		}
+		return f.rename(ev.OldPath, ev.Path, ev.Dir)
+	case watch.Overflow:
+		f.crawl.fail(Failure{Err: errMissed})
+	}
+	return true
+}
+
+// known reports whether the entry at path may have been sent: it is not
+// ignored, and is a directory or of a type asked for.
+func (f *follower) known(path string, dir bool) bool {
+	if f.ignored(path) {
+		return false
+	}
+	return dir || f.crawl.wanted(entry.FileTypeFile) || f.crawl.wanted(entry.FileTypeSymlink)
+}
+
+// create sends the entry created at path, and those already in it when it
+// is a directory, as with mkdir -p or a move from elsewhere.
+func (f *follower) create(path string) bool {
+	queue := []string{path}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if f.added[current] || f.ignored(current) {
+			continue
+		}
+		fi, err := os.Lstat(current)
+		if err != nil {
+			// Already gone again; its removal follows
+			continue
+		}
+		f.added[current] = true
+		p := crawler.Path{Path: current, Type: typeOf(fi.Mode())}
+		if p.Type == entry.FileTypeDir {
+			// Watched before it is read, so nothing created meanwhile is
+			// missed
+			f.watch(current)
+			names, err := readNames(current)
+			if err == nil {
+				p.ModTime = fi.ModTime()
+			}
+			if f.markers != nil {
+				p.Project = f.markers.Kind(names)
+			}
+			for _, name := range names {
+				queue = append(queue, filepath.Join(current, name))
+			}
+		}
+		if !f.send(p, "", "") {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *follower) remove(path string) bool {
+	f.forget(path, "")
+	f.w.Remove(path)
+	return f.sendChange(Change{From: path}) && f.removeArchive(path)
+}
+
+// removeArchive removes the entries crawled inside the archive at path,
+// if any, as they are not below its path.
+func (f *follower) removeArchive(path string) bool {
+	if !f.crawl.opts.Archives || !archive.IsArchive(path) {
+		return true
+	}
+	return f.sendChange(Change{From: path + archive.Sep})
+}
+
+// rename moves the entries at and below from to to.
+func (f *follower) rename(from string, to string, dir bool) bool {
+	f.forget(from, to)
+	p := crawler.Path{Path: to, Type: entry.FileTypeFile}
+	if fi, err := os.Lstat(to); err == nil {
+		p.Type = typeOf(fi.Mode())
+	} else if dir {
+		p.Type = entry.FileTypeDir
+	}
+	if p.Type == entry.FileTypeDir && f.markers != nil {
+		p.Project, _ = f.markers.Detect(to)
+	}
+	return f.send(p, from, to) && f.removeArchive(from)
+}
+
+// forget drops path and the paths below it from those added, or moves
+// them below to.
+func (f *follower) forget(path string, to string) {
+	for p := range f.added {
+		if p != path && !strings.HasPrefix(p, path+"/") {
+			continue
+		}
+		delete(f.added, p)
+		if to != "" {
+			f.added[to+strings.TrimPrefix(p, path)] = true
+		}
+	}
+}
+
+// send sends the entry of p, added, or renamed from when to is set.
+// Renames are sent whatever the type, so the entries below follow.
+func (f *follower) send(p crawler.Path, from string, to string) bool {
+	if to == "" && !f.crawl.wanted(p.Type) {
+		return true
+	}
+	e, err := f.crawl.entry(p)
+	if err != nil {
+		return true
+	}
+	return f.sendChange(Change{From: from, To: to, Entry: e})
+}
+
+func (f *follower) sendChange(c Change) bool {
+	select {
+	case f.out <- c:
+		return true
+	case <-f.ctx.Done():
+		return false
+	}
+}
+
+// ignored reports whether the name of path matches an ignore pattern.
+func (f *follower) ignored(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range f.crawl.opts.Ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the entry type of a file of the given mode.
+func typeOf(mode fs.FileMode) entry.FileType {
+	switch {
+	case mode.IsDir():
+		return entry.FileTypeDir
+	case mode&fs.ModeSymlink != 0:
+		return entry.FileTypeSymlink
+	}
+	return entry.FileTypeFile
+}
+
+// readNames returns the names of the entries of dir, sorted.
+func readNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	slices.Sort(names)
+	return names, err
+}
@@ -0,0 +1,113 @@
+// Package trash moves files to the user's trash as described by the
+// FreeDesktop.org Trash specification, so file managers can list and
+// restore them. Only the home trash is supported: files on another
+// filesystem cannot be moved there and are reported as errors.
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sakolb/bcd/internal/datafile"
+)
+
+var ErrCrossDevice = errors.New("cannot move to the trash across filesystems")
+
+// Dir returns the home trash directory, $XDG_DATA_HOME/Trash.
+func Dir() (string, error) {
+	home, err := datafile.DataHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Trash"), nil
+}
+
+// Move moves path to the trash in dir, recording where it came from, and
+// returns its new location.
+func Move(dir string, path string, now time.Time) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return "", err
+	}
+	filesDir := filepath.Join(dir, "files")
+	infoDir := filepath.Join(dir, "info")
+	for _, d := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(d, 0o700); err != nil {
+			return "", err
+		}
+	}
+
+	info, name, err := reserveInfo(infoDir, filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		escapePath(path), now.Format("2006-01-02T15:04:05"))
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	infoPath := info.Name()
+	if err != nil {
+		os.Remove(infoPath)
+		return "", err
+	}
+
+	target := filepath.Join(filesDir, name)
+	if err := os.Rename(path, target); err != nil {
+		os.Remove(infoPath)
+		if errors.Is(err, syscall.EXDEV) {
+			return "", fmt.Errorf("%w: %s", ErrCrossDevice, path)
+		}
+		return "", err
+	}
+	return target, nil
+}
+
+// reserveInfo creates the .trashinfo file for the first free variant of
+// name. Creating it exclusively claims the name, as the specification
+// requires, so concurrent trashing never picks the same one.
+func reserveInfo(infoDir string, name string) (*os.File, string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = stem + "." + strconv.Itoa(i) + ext
+		}
+		f, err := os.OpenFile(filepath.Join(infoDir, candidate+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := os.Lstat(filepath.Join(infoDir, "..", "files", candidate)); err == nil {
+			// A leftover file without info; keep looking
+			f.Close()
+			os.Remove(f.Name())
+			continue
+		}
+		return f, candidate, nil
+	}
+}
+
+// escapePath percent-encodes path as the specification requires, keeping
+// the separators.
+func escapePath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
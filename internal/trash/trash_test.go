@@ -0,0 +1,53 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMove(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Trash")
+	src := t.TempDir()
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.Local)
+
+	var targets []string
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(src, "my notes.txt")
+		if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		target, err := Move(dir, path, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone, got %v", path, err)
+		}
+		targets = append(targets, target)
+	}
+
+	want := []string{"my notes.txt", "my notes.2.txt"}
+	for i, target := range targets {
+		if filepath.Base(target) != want[i] {
+			t.Errorf("expected %s, got %s", want[i], filepath.Base(target))
+		}
+		info, err := os.ReadFile(filepath.Join(dir, "info", want[i]+".trashinfo"))
+		if err != nil {
+			t.Fatalf("reading trashinfo: %v", err)
+		}
+		if !strings.Contains(string(info), "Path="+src+"/my%20notes.txt\n") ||
+			!strings.Contains(string(info), "DeletionDate=2024-05-01T12:30:00\n") {
+			t.Errorf("unexpected trashinfo:\n%s", info)
+		}
+	}
+}
+
+func TestMoveMissing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Trash")
+	if _, err := Move(dir, filepath.Join(t.TempDir(), "missing"), time.Now()); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error, got %v", err)
+	}
+}
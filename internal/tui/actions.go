@@ -0,0 +1,50 @@
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/action"
+)
+
+type actionDoneMsg struct {
+	name   string
+	exit   bool
+	status string
+	err    error
+}
+
+// runAction runs a on the entry under the cursor. Commands take over the
+// terminal through tea.ExecProcess and hand it back when they exit.
+// Entries in archives are refused, as they don't exist on disk.
+func (m Model) runAction(a action.Action) (tea.Model, tea.Cmd) {
+	if m.cursor >= m.rowCount() {
+		return m, nil
+	}
+	path := m.row(m.cursor).Entry.AbsPath()
+	if m.inArchive(path) {
+		return m, nil
+	}
+
+	cmd := a.Cmd(path)
+	if cmd == nil {
+		// Copying runs no process
+		return m, func() tea.Msg {
+			return actionDoneMsg{name: a.Name, exit: a.Exit, status: "copied " + path, err: action.Copy(path)}
+		}
+	}
+	return m, tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return actionDoneMsg{name: a.Name, exit: a.Exit, err: err}
+	})
+}
+
+func (m Model) actionDone(msg actionDoneMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.status = msg.name + ": " + msg.err.Error()
+		return m, nil
+	}
+	if msg.exit {
+		m.selected = ""
+		return m.quit()
+	}
+	m.status = msg.status
+	return m, nil
+}
@@ -0,0 +1,74 @@
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sakolb/bcd/internal/entry"
+)
+
+// gitResolvedMsg reports that the git metadata of the visible rows has
+// been read.
+type gitResolvedMsg struct{}
+
+// resolveGit reads the git metadata of visible directories that haven't
+// been checked yet. Reading an index can take a while in big repositories,
+// so it happens off the UI goroutine, one batch at a time.
+func (m *Model) resolveGit() tea.Cmd {
+	if m.gitPending || m.quitting {
+		return nil
+	}
+	end := m.viewportOffset + m.visibleRows()
+	if end > m.rowCount() {
+		end = m.rowCount()
+	}
+	var pending []*entry.PathEntry
+	for i := m.viewportOffset; i < end; i++ {
+		e := m.row(i).Entry
+		if e.FType != entry.FileTypeDir {
+			continue
+		}
+		if _, _, known := e.CachedGit(); !known {
+			pending = append(pending, e)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	m.gitPending = true
+	return func() tea.Msg {
+		for _, e := range pending {
+			e.Git()
+		}
+		return gitResolvedMsg{}
+	}
+}
+
+// gitBadge describes the repository rooted at e, if it is known to be one:
+// its branch, or commit when detached, and a star when it has changes.
+func gitBadge(e *entry.PathEntry) string {
+	info, isRepo, known := e.CachedGit()
+	if !known || !isRepo {
+		return ""
+	}
+	badge := " ⎇ " + info.Branch
+	if info.Dirty {
+		badge += "*"
+	}
+	return badge
+}
+
+func renderGitBadge(e *entry.PathEntry, badge string, theme Theme) string {
+	color := theme.GitClean
+	if info, _, _ := e.CachedGit(); info.Dirty {
+		color = theme.GitDirty
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Render(badge)
+}
+
+// projectBadge names the kind of project rooted at e, if any.
+func projectBadge(e *entry.PathEntry) string {
+	if e.Project == "" {
+		return ""
+	}
+	return " [" + e.Project + "]"
+}
@@ -0,0 +1,211 @@
+package tui
+
+import (
+	"path/filepath"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/bookmark"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+// bookmarksMsg carries the bookmarks reloaded after a change, or the error
+// that prevented it.
+type bookmarksMsg struct {
+	bookmarks []bookmark.Bookmark
+	err       error
+}
+
+type promptKind int
+
+const (
+	promptBookmark promptKind = iota
+	promptMkdir
+	promptRename
+)
+
+// verb describes what submitting the prompt does, for the help line.
+func (k promptKind) verb() string {
+	switch k {
+	case promptMkdir:
+		return "create directory"
+	case promptRename:
+		return "rename"
+	default:
+		return "save bookmark"
+	}
+}
+
+func newNamePrompt() textinput.Model {
+	ti := textinput.New()
+	ti.CharLimit = 255
+	return ti
+}
+
+func addBookmarkCmd(file string, name string, path string) tea.Cmd {
+	return func() tea.Msg {
+		if err := bookmark.Add(file, name, path); err != nil {
+			return bookmarksMsg{err: err}
+		}
+		bookmarks, err := bookmark.Load(file)
+		return bookmarksMsg{bookmarks: bookmarks, err: err}
+	}
+}
+
+func removeBookmarkCmd(file string, names ...string) tea.Cmd {
+	return func() tea.Msg {
+		for _, name := range names {
+			if err := bookmark.Remove(file, name); err != nil {
+				return bookmarksMsg{err: err}
+			}
+		}
+		bookmarks, err := bookmark.Load(file)
+		return bookmarksMsg{bookmarks: bookmarks, err: err}
+	}
+}
+
+// setBookmarks replaces the known bookmarks and re-ranks the pinned rows.
+func (m *Model) setBookmarks(bookmarks []bookmark.Bookmark) {
+	m.bookmarks = bookmarks
+	m.bookmarkNames = make(map[string][]string, len(bookmarks))
+	for _, b := range bookmarks {
+		m.bookmarkNames[b.Path] = append(m.bookmarkNames[b.Path], b.Name)
+	}
+	m.refreshPinned()
+}
+
+// refreshPinned ranks the bookmarks against the active query. There are
+// few bookmarks, so this runs synchronously rather than on the worker.
+func (m *Model) refreshPinned() {
+	entries := make([]*entry.PathEntry, 0, len(m.bookmarks))
+	seen := make(map[string]bool, len(m.bookmarks))
+	for _, b := range m.bookmarks {
+		// A path bookmarked under several names is pinned once, with them all
+		if seen[b.Path] {
+			continue
+		}
+		seen[b.Path] = true
+		// Bookmarks whose target no longer exists are not shown
+		e, err := entry.NewPathEntry(b.Path, m.baseDir)
+		if err != nil {
+			continue
+		}
+		e.Origin = entry.OriginOf(source.NameBookmarks)
+		if m.long {
+			e.LoadMetadata()
+		}
+		entries = append(entries, e)
+	}
+	r := ranker.NewRanker()
+	r.SetWeights(m.weights)
+	r.SetTypes(m.types)
+	r.SetSort(m.sortMode)
+	r.AddEntryBatch(entries)
+	r.SetQuery(m.activeQuery)
+	m.pinned = r.Results()
+	m.unpin()
+	if m.activeTab == 0 {
+		m.rebuildTree()
+	}
+	m.clampCursor()
+}
+
+// unpin leaves the pinned bookmarks out of the first tab's rows, so they
+// are not shown twice.
+func (m *Model) unpin() {
+	if len(m.tabs) == 0 {
+		return
+	}
+	first := &m.tabs[0]
+	if len(m.pinned) == 0 {
+		first.rows = first.results
+		return
+	}
+	pinned := make(map[entry.Path]bool, len(m.pinned))
+	for _, p := range m.pinned {
+		pinned[p.Entry.Path] = true
+	}
+	first.rows = make([]ranker.ScoredEntry, 0, len(first.results))
+	for _, r := range first.results {
+		if !pinned[r.Entry.Path] {
+			first.rows = append(first.rows, r)
+		}
+	}
+}
+
+// startBookmarkPrompt asks for a name for the entry under the cursor,
+// suggesting its base name.
+func (m *Model) startBookmarkPrompt() tea.Cmd {
+	if m.bookmarksFile == "" || m.rowCount() == 0 {
+		return nil
+	}
+	path := m.row(m.cursor).Entry.AbsPath()
+	return m.startPrompt(promptBookmark, "Bookmark name: ", path, filepath.Base(path))
+}
+
+// startPrompt opens the name prompt for kind about path, prefilled with
+// value.
+func (m *Model) startPrompt(kind promptKind, prompt string, path string, value string) tea.Cmd {
+	m.promptKind = kind
+	m.promptPath = path
+	m.namePrompt.Prompt = prompt
+	m.namePrompt.SetValue(value)
+	m.prompting = true
+	m.textInput.Blur()
+	return m.namePrompt.Focus()
+}
+
+func (m *Model) endPrompt() tea.Cmd {
+	m.prompting = false
+	m.namePrompt.Blur()
+	return m.textInput.Focus()
+}
+
+// updatePrompt handles keys while the name prompt is open.
+func (m Model) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.selected = ""
+		return m.quit()
+	case "esc":
+		return m, m.endPrompt()
+	case "enter":
+		name := m.namePrompt.Value()
+		var err error
+		var cmd tea.Cmd
+		switch m.promptKind {
+		case promptBookmark:
+			if err = bookmark.ValidateName(name); err == nil {
+				cmd = addBookmarkCmd(m.bookmarksFile, name, m.promptPath)
+			}
+		case promptMkdir:
+			err = m.submitMkdir(name)
+		case promptRename:
+			err = m.submitRename(name)
+		}
+		if err != nil {
+			m.status = err.Error()
+			return m, nil
+		}
+		m.status = ""
+		return m, tea.Batch(m.endPrompt(), cmd)
+	}
+	var cmd tea.Cmd
+	m.namePrompt, cmd = m.namePrompt.Update(msg)
+	return m, cmd
+}
+
+// removeBookmarkUnderCursor deletes the bookmarks of the entry under the
+// cursor, if there are any.
+func (m *Model) removeBookmarkUnderCursor() tea.Cmd {
+	if m.bookmarksFile == "" || m.rowCount() == 0 {
+		return nil
+	}
+	names, ok := m.bookmarkNames[m.row(m.cursor).Entry.AbsPath()]
+	if !ok {
+		return nil
+	}
+	return removeBookmarkCmd(m.bookmarksFile, names...)
+}
@@ -0,0 +1,306 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/archive"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+// dirIndex groups the entries discovered by the crawl by their parent
+// directory, so browse mode can list a directory the crawl already read
+// without touching the disk again. It is filled by the crawl tab's ranker
+// worker once browse mode is first entered, and read from Update, hence
+// the mutex.
+type dirIndex struct {
+	mu sync.Mutex
+	// children maps directories to their entries by name, keyed by path
+	// rather than string so that indexing an entry does not copy its path
+	children map[entry.Path]map[string]*entry.PathEntry
+	// complete holds the directories whose listing is known to be whole
+	complete map[entry.Path]bool
+	// crawled is set once the crawl has finished, completing every directory
+	// once filled is set too, when the entries crawled so far were added
+	crawled bool
+	filled  bool
+	// moved holds the paths renamed since, which the crawl knows nothing
+	// about below
+	moved []entry.Path
+}
+
+func newDirIndex() *dirIndex {
+	return &dirIndex{
+		children: make(map[entry.Path]map[string]*entry.PathEntry),
+		complete: make(map[entry.Path]bool),
+	}
+}
+
+func (ix *dirIndex) add(entries []*entry.PathEntry) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, e := range entries {
+		parent := e.Path.Dir()
+		if parent == e.Path {
+			continue
+		}
+		children, ok := ix.children[parent]
+		if !ok {
+			children = make(map[string]*entry.PathEntry)
+			ix.children[parent] = children
+		}
+		if _, ok := children[e.Path.Base()]; !ok {
+			children[e.Path.Base()] = e
+		}
+	}
+}
+
+// fill adds the entries found before the index was needed.
+func (ix *dirIndex) fill(entries []*entry.PathEntry) {
+	ix.add(entries)
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.filled = true
+}
+
+// rename moves the entry at path to newPath, whose contents are read from
+// disk again when browsed.
+func (ix *dirIndex) rename(path string, newPath string) {
+	ix.mu.Lock()
+	p := entry.MakePath(path)
+	e := ix.children[p.Dir()][p.Base()]
+	ix.mu.Unlock()
+	ix.remove(path)
+	moved := entry.MakePath(newPath)
+	if e != nil {
+		ix.add([]*entry.PathEntry{e.Moved(newPath)})
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.moved = append(ix.moved, moved)
+}
+
+// remove forgets paths and everything below them.
+func (ix *dirIndex) remove(paths ...string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	removed := make(map[entry.Path]bool, len(paths))
+	for _, path := range paths {
+		p := entry.MakePath(path)
+		delete(ix.children[p.Dir()], p.Base())
+		delete(ix.complete, p)
+		removed[p] = true
+	}
+	for dir := range ix.children {
+		for d := dir; ; d = d.Dir() {
+			if removed[d] {
+				delete(ix.children, dir)
+				delete(ix.complete, dir)
+				break
+			}
+			if d == d.Dir() {
+				break
+			}
+		}
+	}
+}
+
+// setListing records a full listing of dir read from disk.
+func (ix *dirIndex) setListing(dir string, entries []*entry.PathEntry) {
+	ix.add(entries)
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.complete[entry.MakePath(dir)] = true
+}
+
+func (ix *dirIndex) setCrawled() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.crawled = true
+}
+
+// list returns the known children of dir and whether that is all of them.
+func (ix *dirIndex) list(path string) ([]*entry.PathEntry, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	dir := entry.MakePath(path)
+	children := ix.children[dir]
+	entries := make([]*entry.PathEntry, 0, len(children))
+	for _, e := range children {
+		entries = append(entries, e)
+	}
+	if ix.complete[dir] {
+		return entries, true
+	}
+	for d := dir; ; d = d.Dir() {
+		if slices.Contains(ix.moved, d) {
+			return entries, false
+		}
+		if d == d.Dir() {
+			break
+		}
+	}
+	return entries, ix.crawled && ix.filled
+}
+
+type dirListingMsg struct {
+	generation int
+	dir        string
+	entries    []*entry.PathEntry
+	err        error
+}
+
+// listDirCmd reads dir from disk, for directories the crawl has not fully
+// covered yet, loading the metadata of entries when long is set.
+func listDirCmd(generation int, dir string, baseDir string, long bool) tea.Cmd {
+	return func() tea.Msg {
+		children, err := os.ReadDir(dir)
+		entries := make([]*entry.PathEntry, 0, len(children))
+		for _, child := range children {
+			e, err := entry.NewPathEntry(filepath.Join(dir, child.Name()), baseDir)
+			if err != nil {
+				continue
+			}
+			e.Origin = entry.OriginOf(source.NameCrawl)
+			if long {
+				e.LoadMetadata()
+			}
+			entries = append(entries, e)
+		}
+		return dirListingMsg{generation: generation, dir: dir, entries: entries, err: err}
+	}
+}
+
+// toggleBrowse switches between the ranked tabs and browsing the base
+// directory one level at a time.
+func (m Model) toggleBrowse() (tea.Model, tea.Cmd) {
+	m.browsing = !m.browsing
+	m.cursor = 0
+	m.viewportOffset = 0
+	if !m.browsing {
+		return m, nil
+	}
+	m.browseDir = m.baseDir
+	return m, tea.Batch(m.indexCrawl(), m.refreshBrowse())
+}
+
+// indexCrawl has the crawl tab's worker fill the browse index, the first
+// time browse mode is entered after the tabs started.
+func (m *Model) indexCrawl() tea.Cmd {
+	if m.indexing {
+		return nil
+	}
+	for _, t := range m.tabs {
+		if t.source.Name() == source.NameCrawl {
+			m.indexing = true
+			return sendRankerCmd(m.ctx, RankerCmd{Index: m.index}, t.rankerCmdChan)
+		}
+	}
+	return nil
+}
+
+// browseTo moves browse mode to dir. The query only filters one level, so
+// it is cleared; focus is the entry to put the cursor on once listed.
+func (m Model) browseTo(dir string, focus string) (tea.Model, tea.Cmd) {
+	if dir == m.browseDir {
+		return m, nil
+	}
+	m.browseDir = dir
+	m.browseFocus = focus
+	m.cursor = 0
+	m.viewportOffset = 0
+	m.textInput.SetValue("")
+	m.pendingQuery = ""
+	m.activeQuery = ""
+	return m, tea.Batch(m.refreshBrowse(), debounceQueryCmd("", 0))
+}
+
+// browseInto enters the directory under the cursor.
+func (m Model) browseInto() (tea.Model, tea.Cmd) {
+	if m.cursor >= m.rowCount() {
+		return m, nil
+	}
+	e := m.row(m.cursor).Entry
+	dir := e.AbsPath()
+	if archive.Inside(dir) {
+		if e.FType != entry.FileTypeDir {
+			return m, nil
+		}
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return m, nil
+	}
+	return m.browseTo(dir, "")
+}
+
+func (m Model) browseUp() (tea.Model, tea.Cmd) {
+	return m.browseTo(filepath.Dir(m.browseDir), m.browseDir)
+}
+
+// refreshBrowse lists the browsed directory from the index, filtered by
+// the query against entry names. Directories the index does not fully
+// know yet are read from disk in the background.
+func (m *Model) refreshBrowse() tea.Cmd {
+	entries, complete := m.index.list(m.browseDir)
+	m.browseRows = filterLevel(entries, m.activeQuery, m.types)
+
+	if m.browseFocus != "" {
+		for i, r := range m.browseRows {
+			if r.Entry.AbsPath() == m.browseFocus {
+				m.cursor = i
+				if m.cursor >= m.viewportOffset+m.visibleRows() {
+					m.viewportOffset = m.cursor - m.visibleRows() + 1
+				}
+				m.browseFocus = ""
+				break
+			}
+		}
+	}
+	m.clampCursor()
+
+	// The crawl sends an archive's entries all at once, and they are not
+	// on disk to be read
+	if complete || m.browseLoading == m.browseDir || archive.Inside(m.browseDir) {
+		return nil
+	}
+	m.browseLoading = m.browseDir
+	return listDirCmd(m.generation, m.browseDir, m.baseDir, m.long)
+}
+
+// filterLevel ranks the entries of one directory of the given types by
+// how well their names match query. Without a query, directories come
+// first, then by name.
+func filterLevel(entries []*entry.PathEntry, query string, types []entry.FileType) []ranker.ScoredEntry {
+	rows := make([]ranker.ScoredEntry, 0, len(entries))
+	for _, e := range entries {
+		if !slices.Contains(types, e.FType) {
+			continue
+		}
+		s := 0
+		if query != "" {
+			matched, fuzzy := ranker.Score(query, e.Path.Base())
+			if !matched {
+				continue
+			}
+			s = fuzzy
+		}
+		rows = append(rows, ranker.ScoredEntry{Entry: e, Score: s})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Score != rows[j].Score {
+			return rows[i].Score > rows[j].Score
+		}
+		iDir := rows[i].Entry.FType == entry.FileTypeDir
+		jDir := rows[j].Entry.FType == entry.FileTypeDir
+		if iDir != jDir {
+			return iDir
+		}
+		return rows[i].Entry.Path.Base() < rows[j].Entry.Path.Base()
+	})
+	return rows
+}
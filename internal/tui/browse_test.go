@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/entry"
+)
+
+// newEntries returns directory entries for paths, as the crawl finds them.
+func newEntries(t *testing.T, paths ...string) []*entry.PathEntry {
+	t.Helper()
+	entries := make([]*entry.PathEntry, 0, len(paths))
+	for _, p := range paths {
+		e, err := entry.NewPathEntryWithType(p, "/", entry.FileTypeDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestDirIndex(t *testing.T) {
+	crawled := []string{"/a", "/a/b", "/a/b/x", "/a/c"}
+	for _, tt := range []struct {
+		name     string
+		change   func(ix *dirIndex)
+		dir      string
+		want     []string
+		complete bool
+	}{
+		{"crawled", func(ix *dirIndex) {}, "/a", []string{"/a/b", "/a/c"}, true},
+		{
+			"crawled before filled",
+			func(ix *dirIndex) { ix.filled = false },
+			"/a", []string{"/a/b", "/a/c"}, false,
+		},
+		{
+			"removed",
+			func(ix *dirIndex) { ix.remove("/a/b") },
+			"/a", []string{"/a/c"}, true,
+		},
+		{
+			// Everything below a removed directory goes with it
+			"below removed",
+			func(ix *dirIndex) { ix.remove("/a/b") },
+			"/a/b", []string{}, true,
+		},
+		{
+			"renamed",
+			func(ix *dirIndex) { ix.rename("/a/b", "/a/d") },
+			"/a", []string{"/a/c", "/a/d"}, true,
+		},
+		{
+			// The crawl never saw what is below a renamed directory
+			"below renamed",
+			func(ix *dirIndex) { ix.rename("/a/b", "/a/d") },
+			"/a/d", []string{}, false,
+		},
+		{
+			"read from disk after renamed",
+			func(ix *dirIndex) {
+				ix.rename("/a/b", "/a/d")
+				ix.setListing("/a/d", newEntries(t, "/a/d/x"))
+			},
+			"/a/d", []string{"/a/d/x"}, true,
+		},
+		{
+			"added",
+			func(ix *dirIndex) { ix.add(newEntries(t, "/a/e")) },
+			"/a", []string{"/a/b", "/a/c", "/a/e"}, true,
+		},
+		{
+			// Entries already known are kept
+			"added again",
+			func(ix *dirIndex) { ix.add(newEntries(t, "/a/b")) },
+			"/a", []string{"/a/b", "/a/c"}, true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ix := newDirIndex()
+			ix.fill(newEntries(t, crawled...))
+			ix.setCrawled()
+			tt.change(ix)
+			entries, complete := ix.list(tt.dir)
+			got := make([]string, 0, len(entries))
+			for _, e := range entries {
+				got = append(got, e.AbsPath())
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) || complete != tt.complete {
+				t.Errorf("list(%s) = %q, %v, want %q, %v", tt.dir, got, complete, tt.want, tt.complete)
+			}
+		})
+	}
+}
+
+func TestDirIndexIncompleteBeforeCrawled(t *testing.T) {
+	ix := newDirIndex()
+	ix.fill(newEntries(t, "/a", "/a/b"))
+	if _, complete := ix.list("/a"); complete {
+		t.Error("expected listings to be incomplete while the crawl runs")
+	}
+	ix.setListing("/a", newEntries(t, "/a/b", "/a/c"))
+	entries, complete := ix.list("/a")
+	if len(entries) != 2 || !complete {
+		t.Errorf("expected both entries read from disk, complete, got %d, %v", len(entries), complete)
+	}
+}
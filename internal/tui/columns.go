@@ -0,0 +1,131 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// minPathWidth is the room kept for paths; metadata columns that don't fit
+// next to it are dropped.
+const minPathWidth = 30
+
+// column is one metadata column shown in the long layout.
+type column struct {
+	width int
+	// priority decides which columns are dropped first in narrow windows,
+	// lowest first
+	priority int
+	render   func(e *entry.PathEntry) string
+	right    bool
+}
+
+// columns are shown in this order, like ls -l.
+var columns = []column{
+	{width: 10, priority: 1, render: func(e *entry.PathEntry) string { return e.Meta.Mode.String() }},
+	{width: 8, priority: 0, render: func(e *entry.PathEntry) string { return e.Meta.Owner() }},
+	{width: 5, priority: 2, render: func(e *entry.PathEntry) string { return humanSize(e.Meta.Size) }, right: true},
+	{width: 12, priority: 3, render: func(e *entry.PathEntry) string { return formatMTime(e.ModTime, time.Now()) }},
+}
+
+// visibleColumns returns the columns that fit in the window.
+func (m Model) visibleColumns() []column {
+	if !m.long {
+		return nil
+	}
+	room := m.safeWidth - minPathWidth
+	fits := make([]bool, len(columns))
+	for p := len(columns) - 1; p >= 0; p-- {
+		for i, c := range columns {
+			if c.priority == p && c.width+1 <= room {
+				fits[i] = true
+				room -= c.width + 1
+			}
+		}
+	}
+	var visible []column
+	for i, c := range columns {
+		if fits[i] {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
+
+// cells renders e's metadata as aligned columns, blank when it has none.
+func cells(cols []column, e *entry.PathEntry) string {
+	if len(cols) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range cols {
+		value := ""
+		if e.Meta != nil {
+			value = c.render(e)
+		}
+		if len(value) > c.width {
+			value = value[:c.width]
+		}
+		if c.right {
+			fmt.Fprintf(&b, "%*s ", c.width, value)
+		} else {
+			fmt.Fprintf(&b, "%-*s ", c.width, value)
+		}
+	}
+	return b.String()
+}
+
+// humanSize formats a size in bytes with a binary unit, like ls -h.
+func humanSize(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d", n)
+	}
+	size := float64(n)
+	i := -1
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if size < 10 {
+		return fmt.Sprintf("%.1f%c", size, units[i])
+	}
+	return fmt.Sprintf("%.0f%c", size, units[i])
+}
+
+// formatMTime shows the time of day for the last six months, and the year
+// before that, like ls -l.
+func formatMTime(t time.Time, now time.Time) string {
+	if now.Sub(t) < 182*24*time.Hour && t.Before(now.Add(time.Hour)) {
+		return t.Format("Jan _2 15:04")
+	}
+	return t.Format("Jan _2  2006")
+}
+
+// cycleSort switches every tab to the next sort mode. Sorting on mtime
+// needs the metadata of files, so it is skipped when it wasn't loaded.
+func (m Model) cycleSort() (tea.Model, tea.Cmd) {
+	i := 0
+	for j, mode := range ranker.SortModes {
+		if mode == m.sortMode {
+			i = j
+		}
+	}
+	m.sortMode = ranker.SortModes[(i+1)%len(ranker.SortModes)]
+	if m.sortMode == ranker.SortMTime && !m.long {
+		m.sortMode = ranker.SortModes[(i+2)%len(ranker.SortModes)]
+	}
+	m.cursor = 0
+	m.viewportOffset = 0
+	m.refreshPinned()
+
+	cmds := make([]tea.Cmd, 0, len(m.tabs))
+	for _, t := range m.tabs {
+		cmds = append(cmds, sendRankerCmd(m.ctx, RankerCmd{SetSort: m.sortMode}, t.rankerCmdChan))
+	}
+	return m, tea.Batch(cmds...)
+}
@@ -0,0 +1,30 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+func TestCycleSort(t *testing.T) {
+	for _, tt := range []struct {
+		long bool
+		want []ranker.SortMode
+	}{
+		{true, []ranker.SortMode{ranker.SortDistance, ranker.SortMTime, ranker.SortName, ranker.SortScore}},
+		// Without metadata, files have no mtime to sort on
+		{false, []ranker.SortMode{ranker.SortDistance, ranker.SortName, ranker.SortScore}},
+	} {
+		m := InitModel("/", Options{Long: tt.long})
+		var got []ranker.SortMode
+		for range tt.want {
+			next, _ := m.cycleSort()
+			m = next.(Model)
+			got = append(got, m.sortMode)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("long=%v: cycled through %q, want %q", tt.long, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// explainHeight is the number of lines the score breakdown takes.
+const explainHeight = 4
+
+// visibleRows is the number of result rows that fit on screen, leaving
+// room for the score breakdown when it is shown.
+func (m Model) visibleRows() int {
+	if m.explaining {
+		return max(m.maxVisibleResult-explainHeight, 1)
+	}
+	return m.maxVisibleResult
+}
+
+// clampViewport scrolls so the cursor stays visible after the number of
+// visible rows changed.
+func (m *Model) clampViewport() {
+	if m.cursor >= m.viewportOffset+m.visibleRows() {
+		m.viewportOffset = m.cursor - m.visibleRows() + 1
+	}
+}
+
+// explanation breaks down the score of the entry under the cursor, with
+// the ranker that placed it there.
+func (m Model) explanation() (ranker.Explanation, bool) {
+	if m.browsing || m.cursor >= m.rowCount() {
+		return ranker.Explanation{}, false
+	}
+	e := m.row(m.cursor).Entry
+	if m.cursor < len(m.pinnedRows()) || len(m.tabs) == 0 {
+		// Pinned bookmarks are ranked without a source bias
+		r := ranker.NewRanker()
+		r.SetWeights(m.weights)
+		return r.Explain(m.activeQuery, e), true
+	}
+	return m.tabs[m.activeTab].ranker.Explain(m.activeQuery, e), true
+}
+
+// explainView shows why the entry under the cursor ranks where it does.
+func (m Model) explainView() string {
+	faint := lipgloss.NewStyle().Faint(true)
+	x, ok := m.explanation()
+	if !ok {
+		return "\n" + faint.Render(" no score breakdown while browsing") + "\n\n\n"
+	}
+	if !x.Matched {
+		// Ancestors in the tree layout are shown for context only
+		return "\n" + faint.Render(" not matched: shown for context") + "\n\n\n"
+	}
+
+	total := fmt.Sprintf(" why: score %d = fuzzy %d + bias %d + project %d", x.Score, x.Fuzzy, x.Bias, x.Project)
+	if x.Kind != "" {
+		total += " (" + x.Kind + ")"
+	}
+	total += fmt.Sprintf(" + recency %d • distance %d", x.Recency, x.Distance)
+
+	parts := make([]string, 0, len(x.Chars)+1)
+	for _, c := range x.Chars {
+		part := fmt.Sprintf("%s %+d", c.Char, c.Match+c.Bonus)
+		if c.BonusKind != "" {
+			part += " " + c.BonusKind
+		}
+		if c.Consecutive != 0 {
+			part += fmt.Sprintf(" %+d consecutive", c.Consecutive)
+		}
+		if c.GapStart != 0 {
+			part += fmt.Sprintf(" %+d gap", c.GapStart)
+		}
+		parts = append(parts, part)
+	}
+	if x.Query != "" {
+		parts = append(parts, fmt.Sprintf("gaps %+d", x.Gaps))
+	} else {
+		parts = append(parts, "empty query: ranked by signals and distance")
+	}
+	chars := "   " + strings.Join(parts, ", ")
+
+	return "\n" + faint.Render(truncate(total, m.safeWidth)) + "\n" +
+		faint.Render(truncate(chars, m.safeWidth)) + "\n" +
+		"   " + highlightMatches(x, m.theme) + "\n"
+}
+
+// highlightMatches renders the explained path with its matched characters
+// highlighted.
+func highlightMatches(x ranker.Explanation, theme Theme) string {
+	matchStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(theme.Match))
+	matched := make(map[int]bool, len(x.Chars))
+	for _, p := range x.Positions() {
+		matched[p] = true
+	}
+	var b strings.Builder
+	for i, r := range []rune(x.Path) {
+		if matched[i] {
+			b.WriteString(matchStyle.Render(string(r)))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// truncate cuts s to width runes, marking the cut with an ellipsis.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if width < 1 || len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,253 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/archive"
+	"github.com/sakolb/bcd/internal/trash"
+)
+
+// confirmation is a yes/no question guarding a file operation.
+type confirmation struct {
+	question string
+	run      tea.Cmd
+}
+
+type fileOp int
+
+const (
+	opMkdir fileOp = iota
+	opRename
+	opTrash
+	opExtract
+)
+
+// fileOpMsg reports a finished file operation.
+type fileOpMsg struct {
+	op   fileOp
+	from string
+	to   string
+	err  error
+}
+
+func mkdirCmd(dir string) tea.Cmd {
+	return func() tea.Msg {
+		err := os.MkdirAll(dir, 0o755)
+		return fileOpMsg{op: opMkdir, to: dir, err: err}
+	}
+}
+
+func renameCmd(from string, to string) tea.Cmd {
+	return func() tea.Msg {
+		// os.Rename silently replaces files, so refuse existing targets
+		if _, err := os.Lstat(to); err == nil {
+			return fileOpMsg{op: opRename, err: fmt.Errorf("%s already exists", to)}
+		}
+		if err := os.Rename(from, to); err != nil {
+			return fileOpMsg{op: opRename, err: err}
+		}
+		return fileOpMsg{op: opRename, from: from, to: to}
+	}
+}
+
+func trashCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		dir, err := trash.Dir()
+		if err != nil {
+			return fileOpMsg{op: opTrash, err: err}
+		}
+		target, err := trash.Move(dir, path, time.Now())
+		return fileOpMsg{op: opTrash, from: path, to: target, err: err}
+	}
+}
+
+// extractCmd extracts the archive at path into a new temporary directory,
+// and reports the entry inner, a slash separated path in the archive, at
+// its extracted path. The directory is left for the shell to go to, and
+// only removed when inner turns out not to be extracted.
+func extractCmd(path string, inner string) tea.Cmd {
+	return func() tea.Msg {
+		dest, err := os.MkdirTemp("", "bcd-"+filepath.Base(path)+"-")
+		if err != nil {
+			return fileOpMsg{op: opExtract, err: err}
+		}
+		if err := archive.Extract(path, dest); err != nil {
+			os.RemoveAll(dest)
+			return fileOpMsg{op: opExtract, err: err}
+		}
+		to := filepath.Join(dest, filepath.FromSlash(inner))
+		if _, err := os.Stat(to); err != nil {
+			os.RemoveAll(dest)
+			return fileOpMsg{op: opExtract, err: fmt.Errorf("%s is not extracted: only directories, files and links within the archive are", inner)}
+		}
+		return fileOpMsg{op: opExtract, from: path, to: to}
+	}
+}
+
+// cursorDir returns the directory of the entry under the cursor: the entry
+// itself for directories, its parent otherwise, and the base directory
+// when there are no results.
+func (m Model) cursorDir() string {
+	if m.cursor >= m.rowCount() {
+		return m.baseDir
+	}
+	path := m.row(m.cursor).Entry.AbsPath()
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path
+	}
+	return filepath.Dir(path)
+}
+
+// inArchive reports whether path is inside an archive, which nothing but
+// extraction can touch, and says so in the status bar.
+func (m *Model) inArchive(path string) bool {
+	if !archive.Inside(path) {
+		return false
+	}
+	m.status = path + " is in an archive: press enter to extract it first"
+	return true
+}
+
+// startMkdirPrompt asks for the name of a directory to create under the
+// entry under the cursor.
+func (m *Model) startMkdirPrompt() tea.Cmd {
+	parent := m.cursorDir()
+	if m.inArchive(parent) {
+		return nil
+	}
+	return m.startPrompt(promptMkdir, "New directory in "+parent+"/: ", parent, "")
+}
+
+// startRenamePrompt asks for a new name for the entry under the cursor.
+func (m *Model) startRenamePrompt() tea.Cmd {
+	if m.cursor >= m.rowCount() {
+		return nil
+	}
+	path := m.row(m.cursor).Entry.AbsPath()
+	if m.inArchive(path) {
+		return nil
+	}
+	return m.startPrompt(promptRename, "Rename to: ", path, filepath.Base(path))
+}
+
+// confirmTrash asks before moving the entry under the cursor to the trash.
+func (m *Model) confirmTrash() {
+	if m.cursor >= m.rowCount() {
+		return
+	}
+	path := m.row(m.cursor).Entry.AbsPath()
+	if m.inArchive(path) {
+		return
+	}
+	m.confirm = &confirmation{
+		question: fmt.Sprintf("Move %s to the trash? (y/n)", path),
+		run:      trashCmd(path),
+	}
+}
+
+// confirmExtract asks before extracting the archive path is in, to select
+// path in the extracted copy.
+func (m *Model) confirmExtract(path string) {
+	file, inner, _ := archive.Split(path)
+	m.confirm = &confirmation{
+		question: fmt.Sprintf("Extract %s to a temporary directory and go there? (y/n)", filepath.Base(file)),
+		run:      extractCmd(file, inner),
+	}
+}
+
+// submitMkdir checks the name typed in the prompt and asks to confirm.
+func (m *Model) submitMkdir(name string) error {
+	if name == "" || !filepath.IsLocal(name) {
+		return fmt.Errorf("invalid directory name %q", name)
+	}
+	dir := filepath.Join(m.promptPath, name)
+	if _, err := os.Lstat(dir); err == nil {
+		return fmt.Errorf("%s already exists", dir)
+	}
+	m.confirm = &confirmation{
+		question: fmt.Sprintf("Create %s? (y/n)", dir),
+		run:      mkdirCmd(dir),
+	}
+	return nil
+}
+
+// submitRename checks the new name typed in the prompt and asks to
+// confirm.
+func (m *Model) submitRename(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	to := filepath.Join(filepath.Dir(m.promptPath), name)
+	if to == m.promptPath {
+		return nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s already exists", to)
+	}
+	m.confirm = &confirmation{
+		question: fmt.Sprintf("Rename %s to %s? (y/n)", m.promptPath, name),
+		run:      renameCmd(m.promptPath, to),
+	}
+	return nil
+}
+
+// updateConfirm handles the answer to a confirmation: y runs the
+// operation, anything else cancels it.
+func (m Model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	c := m.confirm
+	m.confirm = nil
+	switch msg.String() {
+	case "ctrl+c":
+		m.selected = ""
+		return m.quit()
+	case "y", "Y":
+		m.status = ""
+		return m, c.run
+	}
+	m.status = "cancelled"
+	return m, nil
+}
+
+// fileOpDone updates the results in place after a file operation, without
+// crawling again. A new directory is selected right away, so the shell
+// moves into it.
+func (m Model) fileOpDone(msg fileOpMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		var pathErr *fs.PathError
+		if errors.As(msg.err, &pathErr) {
+			m.status = pathErr.Op + " " + pathErr.Path + ": " + pathErr.Err.Error()
+		} else {
+			m.status = msg.err.Error()
+		}
+		return m, nil
+	}
+
+	var cmd RankerCmd
+	switch msg.op {
+	case opMkdir, opExtract:
+		m.selected = msg.to
+		return m.quit()
+	case opRename:
+		m.status = "renamed to " + msg.to
+		cmd = RankerCmd{RenameFrom: msg.from, RenameTo: msg.to}
+	case opTrash:
+		m.status = "moved to " + msg.to
+		cmd = RankerCmd{RemovePaths: []string{msg.from}}
+	}
+
+	cmds := make([]tea.Cmd, 0, len(m.tabs)+1)
+	for _, t := range m.tabs {
+		cmds = append(cmds, sendRankerCmd(m.ctx, cmd, t.rankerCmdChan))
+	}
+	if m.browsing {
+		cmds = append(cmds, m.refreshBrowse())
+	}
+	return m, tea.Batch(cmds...)
+}
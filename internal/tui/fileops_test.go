@@ -0,0 +1,135 @@
+package tui
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/action"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+func TestSubmitMkdir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "taken"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		// err is part of the error expected, "" for none
+		err string
+	}{
+		{"new", ""},
+		{"new/nested", ""},
+		{"", "invalid directory name"},
+		{"../out", "invalid directory name"},
+		{"/abs", "invalid directory name"},
+		{"taken", "already exists"},
+	} {
+		m := InitModel(dir, Options{})
+		m.promptPath = dir
+		err := m.submitMkdir(tt.name)
+		if tt.err == "" {
+			if err != nil || m.confirm == nil {
+				t.Errorf("%q: expected a confirmation, got %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) || m.confirm != nil {
+			t.Errorf("%q: expected %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestSubmitRename(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"old", "taken"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		name    string
+		err     string
+		confirm bool
+	}{
+		{"new", "", true},
+		// Keeping the name is not an error, nor anything to do
+		{"old", "", false},
+		{"", "invalid name", false},
+		{".", "invalid name", false},
+		{"..", "invalid name", false},
+		{"a/b", "invalid name", false},
+		{"taken", "already exists", false},
+	} {
+		m := InitModel(dir, Options{})
+		m.promptPath = filepath.Join(dir, "old")
+		err := m.submitRename(tt.name)
+		if (tt.err == "") != (err == nil) || err != nil && !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: expected error %q, got %v", tt.name, tt.err, err)
+		}
+		if (m.confirm != nil) != tt.confirm {
+			t.Errorf("%q: expected confirmation %v, got %v", tt.name, tt.confirm, m.confirm != nil)
+		}
+	}
+}
+
+func TestFileOpDone(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		msg      fileOpMsg
+		status   string
+		selected string
+	}{
+		{
+			"failed",
+			fileOpMsg{op: opMkdir, err: &fs.PathError{Op: "mkdir", Path: "/x", Err: fs.ErrPermission}},
+			"mkdir /x: permission denied", "",
+		},
+		{"failed without a path", fileOpMsg{op: opRename, err: errors.New("/y already exists")}, "/y already exists", ""},
+		{"failed to extract", fileOpMsg{op: opExtract, err: errors.New("bad archive")}, "bad archive", ""},
+		// New directories and extracted copies are gone to right away
+		{"mkdir", fileOpMsg{op: opMkdir, to: "/x"}, "", "/x"},
+		{"extract", fileOpMsg{op: opExtract, from: "/a.zip", to: "/tmp/bcd-a.zip-1/a"}, "", "/tmp/bcd-a.zip-1/a"},
+		{"rename", fileOpMsg{op: opRename, from: "/x", to: "/y"}, "renamed to /y", ""},
+		{"trash", fileOpMsg{op: opTrash, from: "/x", to: "/trash/x"}, "moved to /trash/x", ""},
+	} {
+		next, _ := InitModel("/", Options{}).fileOpDone(tt.msg)
+		m := next.(Model)
+		if m.status != tt.status || m.selected != tt.selected || m.quitting != (tt.selected != "") {
+			t.Errorf("%s: got status %q, selected %q, quitting %v", tt.name, m.status, m.selected, m.quitting)
+		}
+	}
+}
+
+func TestFileOpsRefuseArchives(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		run  func(m *Model)
+	}{
+		// The entry's parent is the archive, which isn't a directory either
+		{"mkdir", func(m *Model) { m.startMkdirPrompt() }},
+		{"rename", func(m *Model) { m.startRenamePrompt() }},
+		{"trash", func(m *Model) { m.confirmTrash() }},
+		{"action", func(m *Model) {
+			next, _ := m.runAction(action.Action{Name: action.NameExecute, Command: "touch {}"})
+			*m = next.(Model)
+		}},
+	} {
+		e, err := entry.NewPathEntryWithType("/p/foo.zip!/a", "/p", entry.FileTypeFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := InitModel("/p", Options{Sources: []source.Source{source.NewStatic(source.NameCrawl, nil)}})
+		m.tabs[0].rows = []ranker.ScoredEntry{{Entry: e}}
+		tt.run(&m)
+		if m.prompting || m.confirm != nil || !strings.Contains(m.status, "in an archive") {
+			t.Errorf("%s: expected to be refused, got prompting %v, confirmation %v, status %q", tt.name, m.prompting, m.confirm != nil, m.status)
+		}
+	}
+}
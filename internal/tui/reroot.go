@@ -0,0 +1,83 @@
+package tui
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+// reroot restarts every source from dir. The running crawl is cancelled,
+// each tab gets a fresh ranker, and distances are measured from dir,
+// while the query is kept.
+func (m Model) reroot(dir string) (tea.Model, tea.Cmd) {
+	if m.newSources == nil {
+		m.status = "these results cannot be re-rooted"
+		return m, nil
+	}
+	dir = filepath.Clean(dir)
+	if dir == m.baseDir {
+		return m, nil
+	}
+
+	m.cancel()
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.generation++
+	m.baseDir = dir
+	m.tabs = m.newTabs(m.newSources(dir), m.activeQuery)
+	if m.activeTab >= len(m.tabs) {
+		m.activeTab = 0
+	}
+	m.cursor = 0
+	m.viewportOffset = 0
+	m.status = ""
+	m.rebuildTree()
+	m.refreshPinned()
+	// Cached entries measure distance from the old base, so start over
+	m.index = newDirIndex()
+	m.indexing = false
+	m.startTabs()
+	// Restart the spinner for the new crawl; a tick still pending from the
+	// old one is dropped by the spinner itself
+	if m.browsing {
+		m.browseDir = dir
+		m.browseLoading = ""
+		return m, tea.Batch(m.spinner.Tick, m.indexCrawl(), m.refreshBrowse())
+	}
+	return m, m.spinner.Tick
+}
+
+// rerootUnderCursor re-roots at the entry under the cursor, or at its
+// parent when it is not a directory.
+func (m Model) rerootUnderCursor() (tea.Model, tea.Cmd) {
+	if m.cursor >= m.rowCount() {
+		return m, nil
+	}
+	dir := m.row(m.cursor).Entry.AbsPath()
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	return m.reroot(dir)
+}
+
+func (m Model) rerootHome() (tea.Model, tea.Cmd) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		m.status = err.Error()
+		return m, nil
+	}
+	return m.reroot(home)
+}
+
+// rerootRepo re-roots at the root of the git repository containing the
+// base directory.
+func (m Model) rerootRepo() (tea.Model, tea.Cmd) {
+	root, ok := source.RepoRoot(m.baseDir)
+	if !ok {
+		m.status = "not inside a git repository"
+		return m, nil
+	}
+	return m.reroot(root)
+}
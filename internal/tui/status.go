@@ -0,0 +1,125 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sakolb/bcd/internal/source"
+)
+
+func newSpinner() spinner.Model {
+	return spinner.New(spinner.WithSpinner(spinner.Dot))
+}
+
+// reporter returns the first source that reports crawl progress.
+func (m Model) reporter() (source.StatsReporter, bool) {
+	for _, t := range m.tabs {
+		src := t.source
+		for {
+			if r, ok := src.(source.StatsReporter); ok {
+				return r, true
+			}
+			w, ok := src.(interface{ Unwrap() source.Source })
+			if !ok {
+				break
+			}
+			src = w.Unwrap()
+		}
+	}
+	return nil, false
+}
+
+// updateSpinner advances the spinner until the crawl has finished. The
+// ticks also redraw the status bar, so it stays live between results.
+func (m Model) updateSpinner(msg spinner.TickMsg) (tea.Model, tea.Cmd) {
+	r, ok := m.reporter()
+	if !ok || r.Stats().Done {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	return m, cmd
+}
+
+// statusBarView shows the crawl's progress: what has been scanned, how
+// fast, how deep, and how many directories could not be read.
+func (m Model) statusBarView() string {
+	r, ok := m.reporter()
+	if !ok {
+		return ""
+	}
+	s := r.Stats()
+
+	state := m.spinner.View() + " crawling"
+	if s.Done {
+		state = fmt.Sprintf("✓ crawled in %.1fs", s.Elapsed.Seconds())
+	}
+	parts := []string{
+		state,
+		fmt.Sprintf("%d dirs", s.Dirs),
+		fmt.Sprintf("%d files", s.Files),
+		fmt.Sprintf("%.0f/s", s.Rate()),
+		fmt.Sprintf("depth %d", s.Depth),
+	}
+	if s.PermissionDenied > 0 {
+		parts = append(parts, fmt.Sprintf("%d denied", s.PermissionDenied))
+	}
+	if s.Errors > 0 {
+		parts = append(parts, fmt.Sprintf("%d errors", s.Errors))
+	}
+	if s.PermissionDenied+s.Errors > 0 {
+		parts = append(parts, "alt+e: show failed")
+	}
+	return lipgloss.NewStyle().Faint(true).Render(" "+strings.Join(parts, " • ")) + "\n"
+}
+
+// updateFailures handles keys while the failed paths are listed.
+func (m Model) updateFailures(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.selected = ""
+		return m.quit()
+	case "esc", "alt+e":
+		m.showFailures = false
+	case "up", "ctrl+p":
+		if m.failuresOffset > 0 {
+			m.failuresOffset--
+		}
+	case "down", "ctrl+n":
+		if r, ok := m.reporter(); ok && m.failuresOffset < len(r.Failures())-1 {
+			m.failuresOffset++
+		}
+	}
+	return m, nil
+}
+
+// failuresView lists the paths the crawl could not read, in place of the
+// results.
+func (m Model) failuresView() string {
+	var b strings.Builder
+	var failures []source.Failure
+	if r, ok := m.reporter(); ok {
+		failures = r.Failures()
+	}
+
+	b.WriteString(fmt.Sprintf("	%d failed paths\n", len(failures)))
+	b.WriteString(strings.Repeat("-", m.safeWidth) + "\n")
+
+	offset := min(m.failuresOffset, len(failures))
+	end := min(offset+m.maxVisibleResult, len(failures))
+	for _, f := range failures[offset:end] {
+		line := fmt.Sprintf("%s: %v", f.Path, f.Err)
+		if m.safeWidth > 3 && len(line) > m.safeWidth {
+			line = line[:m.safeWidth-3] + "..."
+		}
+		b.WriteString("  " + line + "\n")
+	}
+	if rest := len(failures) - end; rest > 0 {
+		b.WriteString(fmt.Sprintf("\n	... and %d more\n", rest))
+	}
+	b.WriteString("\n, ↑/↓: scroll • esc: back to results\n")
+	return b.String()
+}
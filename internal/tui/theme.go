@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Theme holds the picker's colors, as lipgloss colors: an ANSI 256 color
+// number such as "42", or a hex color such as "#5fd787".
+type Theme struct {
+	// Cursor is the background of the entry under the cursor
+	Cursor string
+	// Match colors matched characters and the matches in tree layout
+	Match    string
+	Bookmark string
+	Project  string
+	GitClean string
+	GitDirty string
+}
+
+// DefaultTheme returns the colors the picker uses unless told otherwise.
+func DefaultTheme() Theme {
+	return Theme{
+		Cursor:   "22",
+		Match:    "42",
+		Bookmark: "220",
+		Project:  "141",
+		GitClean: "39",
+		GitDirty: "208",
+	}
+}
+
+// ThemeColors are the names of a Theme's colors, in the order they are
+// listed.
+var ThemeColors = []string{"cursor", "match", "bookmark", "project", "git-clean", "git-dirty"}
+
+var ErrInvalidColor = errors.New("invalid color")
+
+// Set sets the color called name to value.
+func (t *Theme) Set(name string, value string) error {
+	c := t.color(name)
+	if c == nil {
+		return fmt.Errorf("%w: unknown color %q (expected %s)", ErrInvalidColor, name, strings.Join(ThemeColors, ", "))
+	}
+	if !validColor(value) {
+		return fmt.Errorf("%w: %s=%s (expected a number from 0 to 255 or #rrggbb)", ErrInvalidColor, name, value)
+	}
+	*c = value
+	return nil
+}
+
+// Get returns the color called name, or "" if there is none.
+func (t Theme) Get(name string) string {
+	if c := t.color(name); c != nil {
+		return *c
+	}
+	return ""
+}
+
+// ParseColor sets a "NAME=COLOR" color in t.
+func (t *Theme) ParseColor(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%w: %q (expected NAME=COLOR)", ErrInvalidColor, s)
+	}
+	return t.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+}
+
+func (t *Theme) color(name string) *string {
+	switch name {
+	case "cursor":
+		return &t.Cursor
+	case "match":
+		return &t.Match
+	case "bookmark":
+		return &t.Bookmark
+	case "project":
+		return &t.Project
+	case "git-clean":
+		return &t.GitClean
+	case "git-dirty":
+		return &t.GitDirty
+	}
+	return nil
+}
+
+// validColor reports whether s is an ANSI 256 color number or a hex color,
+// the colors every terminal bcd supports can show.
+func validColor(s string) bool {
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) != 6 && len(hex) != 3 {
+			return false
+		}
+		for _, r := range hex {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+		return true
+	}
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+		n = n*10 + int(r-'0')
+		if n > 255 {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/entry"
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+// maxTreeResults bounds how many of the best results the tree layout
+// groups, so rebuilding it stays cheap while a crawl streams in.
+const maxTreeResults = 500
+
+// treeRow is one visible row of the tree layout.
+type treeRow struct {
+	result ranker.ScoredEntry
+	// matched is false for ancestors that are only shown for context
+	matched bool
+	// prefix holds the branch lines drawn before the label
+	prefix string
+	label  string
+}
+
+type treeNode struct {
+	name     string
+	path     string
+	result   *ranker.ScoredEntry
+	children []*treeNode
+	byName   map[string]*treeNode
+}
+
+func (n *treeNode) child(name string) *treeNode {
+	if c, ok := n.byName[name]; ok {
+		return c
+	}
+	c := &treeNode{name: name, path: filepath.Join(n.path, name), byName: map[string]*treeNode{}}
+	n.byName[name] = c
+	n.children = append(n.children, c)
+	return c
+}
+
+// collapse merges chains of unmatched single-child directories into one
+// node, so only the ancestors where results branch out take a row.
+func (n *treeNode) collapse() *treeNode {
+	for n.result == nil && len(n.children) == 1 {
+		c := n.children[0]
+		n = &treeNode{
+			name:     filepath.Join(n.name, c.name),
+			path:     c.path,
+			result:   c.result,
+			children: c.children,
+		}
+	}
+	for i, c := range n.children {
+		n.children[i] = c.collapse()
+	}
+	return n
+}
+
+// buildTree groups results under their common ancestors. Results arrive
+// best first and siblings keep insertion order, so every branch is sorted
+// by the best result it holds.
+func buildTree(results []ranker.ScoredEntry, baseDir string) []treeRow {
+	if len(results) > maxTreeResults {
+		results = results[:maxTreeResults]
+	}
+	root := &treeNode{name: "/", path: "/", byName: map[string]*treeNode{}}
+	for i := range results {
+		n := root
+		for _, part := range strings.Split(results[i].Entry.AbsPath(), string(filepath.Separator)) {
+			if part != "" {
+				n = n.child(part)
+			}
+		}
+		if n.result == nil {
+			n.result = &results[i]
+		}
+	}
+	if len(results) == 0 {
+		return nil
+	}
+
+	var rows []treeRow
+	var walk func(n *treeNode, prefix, branch string)
+	walk = func(n *treeNode, prefix, branch string) {
+		row := treeRow{prefix: prefix + branch, label: n.name}
+		if n.result != nil {
+			row.result = *n.result
+			row.matched = true
+		} else {
+			// Ancestors are still selectable, as directories
+			e, err := entry.NewPathEntryWithType(n.path, baseDir, entry.FileTypeDir)
+			if err != nil {
+				return
+			}
+			row.result = ranker.ScoredEntry{Entry: e}
+		}
+		rows = append(rows, row)
+
+		childPrefix := prefix
+		switch branch {
+		case "├── ":
+			childPrefix += "│   "
+		case "└── ":
+			childPrefix += "    "
+		}
+		for i, c := range n.children {
+			if i == len(n.children)-1 {
+				walk(c, childPrefix, "└── ")
+			} else {
+				walk(c, childPrefix, "├── ")
+			}
+		}
+	}
+	walk(root.collapse(), "", "")
+	return rows
+}
+
+// toggleTree switches the results between a flat list and the tree layout.
+func (m Model) toggleTree() (tea.Model, tea.Cmd) {
+	m.treeView = !m.treeView
+	m.cursor = 0
+	m.viewportOffset = 0
+	m.rebuildTree()
+	return m, nil
+}
+
+func (m *Model) rebuildTree() {
+	if !m.treeView || len(m.tabs) == 0 {
+		m.treeRows = nil
+		return
+	}
+	m.treeRows = buildTree(m.tabs[m.activeTab].rows, m.baseDir)
+	m.clampCursor()
+}
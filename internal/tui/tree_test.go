@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/ranker"
+)
+
+func TestBuildTree(t *testing.T) {
+	// Rows are written as drawn, with a * after the matched ones
+	for _, tt := range []struct {
+		name    string
+		results []string
+		want    []string
+	}{
+		{"none", nil, nil},
+		{
+			// Unmatched single-child ancestors take one row
+			"single",
+			[]string{"/home/u/src/a"},
+			[]string{"/home/u/src/a*"},
+		},
+		{
+			"branches",
+			[]string{"/p/a/x", "/p/a/y", "/p/b"},
+			[]string{"/p", "├── a", "│   ├── x*", "│   └── y*", "└── b*"},
+		},
+		{
+			// Siblings come in the order of their best result
+			"best first",
+			[]string{"/p/b", "/p/a/x"},
+			[]string{"/p", "├── b*", "└── a/x*"},
+		},
+		{
+			// A matched directory keeps its own row
+			"matched ancestor",
+			[]string{"/p", "/p/q/r"},
+			[]string{"/p*", "└── q/r*"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []ranker.ScoredEntry
+			for _, e := range newEntries(t, tt.results...) {
+				results = append(results, ranker.ScoredEntry{Entry: e})
+			}
+			var got []string
+			for _, row := range buildTree(results, "/") {
+				line := row.prefix + row.label
+				if row.matched {
+					line += "*"
+				}
+				got = append(got, line)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTreeSelectsAncestors(t *testing.T) {
+	var results []ranker.ScoredEntry
+	for _, e := range newEntries(t, "/p/a/x", "/p/a/y", "/p/b") {
+		results = append(results, ranker.ScoredEntry{Entry: e})
+	}
+	rows := buildTree(results, "/")
+	var got []string
+	for _, row := range rows {
+		got = append(got, row.result.Entry.AbsPath())
+	}
+	want := []string{"/p", "/p/a", "/p/a/x", "/p/a/y", "/p/b"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
@@ -1,89 +1,290 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/sakolb/bcd/internal/action"
+	"github.com/sakolb/bcd/internal/archive"
+	"github.com/sakolb/bcd/internal/bookmark"
 	"github.com/sakolb/bcd/internal/entry"
 	"github.com/sakolb/bcd/internal/ranker"
+	"github.com/sakolb/bcd/internal/source"
 )
 
 const (
 	verticalMargin   = 20
 	horizontalMargin = 5
-)
-
-type EntryMsg *entry.PathEntry
 
-type CrawlDoneMsg struct{}
+	// Entries are handed to the ranker in batches of batchSize, or whatever
+	// arrived within batchInterval, whichever comes first
+	batchSize     = 100
+	batchInterval = 50 * time.Millisecond
+)
 
 type QueryUpdateMsg struct {
 	query string
 }
 
+// RankerCmd is an instruction for the ranker of one tab.
 type RankerCmd struct {
 	AddEntryBatch []*entry.PathEntry
 	SetQuery      *string
+	// SetTypes restricts the results to these file types; nil leaves the
+	// filter unchanged
+	SetTypes []entry.FileType
+	// SetSort changes the order of the results; empty leaves it unchanged
+	SetSort ranker.SortMode
+	// RemovePaths drops entries and everything below them, RenameFrom and
+	// RenameTo move them, after a file operation or a change on disk
+	RemovePaths []string
+	RenameFrom  string
+	RenameTo    string
+	// Index has the worker fill the browse index with the tab's entries,
+	// and keep it up to date with them from then on
+	Index *dirIndex
+	// Done marks the end of the tab's source.
+	Done bool
 }
 
+// maxResults bounds how many of the best results a tab lists: sorting
+// every match on each update would not keep up with millions of entries.
+const maxResults = 1000
+
 type ResultsUpdateMsg struct {
+	// generation identifies the set of tabs the results belong to, so
+	// late results from before a re-root are dropped
+	generation int
+	tab        int
+	// results are the best maxResults of matches
 	results []ranker.ScoredEntry
+	matches int
+	done    bool
+}
+
+// tab holds the state of one source shown in the tab bar. Each tab has
+// its own ranker worker, so a large crawl never delays the small sources.
+type tab struct {
+	source        source.Source
+	ranker        *ranker.Ranker
+	rankerCmdChan chan RankerCmd
+	results       []ranker.ScoredEntry
+	// matches counts the results, of which only the best are listed
+	matches int
+	// rows are the results shown: those of the first tab leave out the
+	// pinned bookmarks, which are shown above them
+	rows []ranker.ScoredEntry
+	done bool
 }
 
 type Model struct {
 	textInput      textinput.Model
-	ranker         *ranker.Ranker
-	results        []ranker.ScoredEntry
+	tabs           []tab
+	activeTab      int
 	cursor         int
 	viewportOffset int
 	selected       string
 	quitting       bool
 	baseDir        string
 
+	// newSources rebuilds the tabs for a new base directory; nil when the
+	// results cannot be re-rooted
+	newSources func(baseDir string) []source.Source
+	generation int
+
+	// Browse mode lists one directory at a time instead of the ranked tabs,
+	// using what the crawl discovered as a cache
+	browsing      bool
+	browseDir     string
+	browseRows    []ranker.ScoredEntry
+	browseFocus   string
+	browseLoading string
+	index         *dirIndex
+	// indexing is set once the crawl tab was asked to fill index
+	indexing bool
+
+	// The tree layout groups the active tab's best results under their
+	// common ancestors
+	treeView bool
+	treeRows []treeRow
+
 	pendingQuery string
 	activeQuery  string
+	// types are the file types shown, toggled at runtime
+	types []entry.FileType
+	// long shows the entries' metadata as columns; sortMode orders results
+	long     bool
+	sortMode ranker.SortMode
+	weights  ranker.Weights
+	// explaining shows the score breakdown of the entry under the cursor
+	explaining bool
+	theme      Theme
 
-	rankerCmdChan    chan RankerCmd
-	rankerResultChan chan ResultsUpdateMsg
+	bindings action.Bindings
 
-	entryBatch []*entry.PathEntry
+	rankerResultChan chan ResultsUpdateMsg
 
-	mu sync.Mutex
+	// ctx stops the sources and workers when the picker exits or re-roots
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	windowWidth      int
 	windowHeight     int
 	maxVisibleResult int
 	safeWidth        int
+
+	// Bookmarks matching the query are pinned above the first tab's results
+	bookmarksFile string
+	bookmarks     []bookmark.Bookmark
+	bookmarkNames map[string][]string
+	pinned        []ranker.ScoredEntry
+
+	// namePrompt asks for a name: a bookmark's, a new directory's, or the
+	// new name of a renamed entry, as told by promptKind
+	namePrompt textinput.Model
+	prompting  bool
+	promptKind promptKind
+	promptPath string
+	// confirm is the pending yes/no question guarding a file operation
+	confirm *confirmation
+
+	status string
+
+	// The status bar shows crawl progress with a spinner until it is done,
+	// and the paths it failed to read can be listed in place of results
+	spinner        spinner.Model
+	showFailures   bool
+	failuresOffset int
+
+	// gitPending is set while the git metadata of visible rows is read
+	gitPending bool
+}
+
+// Options configures a Model beyond its base directory.
+type Options struct {
+	// Query seeds the search input.
+	Query string
+	// BookmarksFile enables the pinned bookmarks section; empty disables it.
+	BookmarksFile string
+	// Sources are shown as tabs, in order. The first one is active at start.
+	Sources []source.Source
+	// NewSources builds the sources for another base directory, which
+	// enables the re-root keys. Nil disables them.
+	NewSources func(baseDir string) []source.Source
+	// Types are the file types shown at start; empty shows all of them.
+	Types []entry.FileType
+	// Bindings are the actions run on the entry under the cursor.
+	Bindings action.Bindings
+	// Long shows the mtime, size, mode and owner of entries that have
+	// metadata, and allows sorting by mtime.
+	Long bool
+	// Sort is the initial order of the results; empty sorts by score.
+	Sort ranker.SortMode
+	// Weights tune the ranking signals; nil uses the defaults.
+	Weights *ranker.Weights
+	// Explain opens the score breakdown of the entry under the cursor.
+	Explain bool
+	// Theme colors the picker; nil uses the default theme.
+	Theme *Theme
 }
 
-func InitModel(baseDir string) Model {
+func InitModel(baseDir string, opts Options) Model {
 	ti := textinput.New()
 	ti.Placeholder = "Search..."
 	ti.Focus()
 	ti.CharLimit = 256
 	ti.Width = 60
+	ti.SetValue(opts.Query)
 
-	cmdChan := make(chan RankerCmd, 1000)
-	resultChan := make(chan ResultsUpdateMsg, 1)
+	resultChan := make(chan ResultsUpdateMsg, 100)
 
-	return Model{
+	types := opts.Types
+	if len(types) == 0 {
+		types = allTypes
+	}
+	sortMode := opts.Sort
+	if sortMode == "" {
+		sortMode = ranker.SortScore
+	}
+	weights := ranker.DefaultWeights()
+	if opts.Weights != nil {
+		weights = *opts.Weights
+	}
+	theme := DefaultTheme()
+	if opts.Theme != nil {
+		theme = *opts.Theme
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m := Model{
 		textInput:        ti,
-		ranker:           ranker.NewRanker(),
-		results:          []ranker.ScoredEntry{},
 		cursor:           0,
 		viewportOffset:   0,
 		baseDir:          baseDir,
-		pendingQuery:     "",
+		newSources:       opts.NewSources,
+		index:            newDirIndex(),
+		pendingQuery:     opts.Query,
+		types:            types,
+		long:             opts.Long,
+		sortMode:         sortMode,
+		weights:          weights,
+		explaining:       opts.Explain,
+		theme:            theme,
+		bindings:         opts.Bindings,
 		activeQuery:      "",
-		rankerCmdChan:    cmdChan,
 		rankerResultChan: resultChan,
-		entryBatch:       make([]*entry.PathEntry, 0, 100),
+		ctx:              ctx,
+		cancel:           cancel,
+		bookmarksFile:    opts.BookmarksFile,
+		namePrompt:       newNamePrompt(),
+		spinner:          newSpinner(),
+	}
+	m.tabs = m.newTabs(opts.Sources, "")
+	if m.bookmarksFile != "" {
+		bookmarks, err := bookmark.Load(m.bookmarksFile)
+		if err != nil {
+			m.status = err.Error()
+		}
+		m.setBookmarks(bookmarks)
+	}
+	return m
+}
+
+// newTabs creates a tab for each source, with a ranker already set to
+// query and the model's types, sort mode and weights.
+func (m Model) newTabs(sources []source.Source, query string) []tab {
+	tabs := make([]tab, len(sources))
+	for i, src := range sources {
+		r := src.NewRanker()
+		r.SetWeights(m.weights)
+		r.SetTypes(m.types)
+		r.SetSort(m.sortMode)
+		if query != "" {
+			r.SetQuery(query)
+		}
+		tabs[i] = tab{
+			source:        src,
+			ranker:        r,
+			rankerCmdChan: make(chan RankerCmd, 1000),
+			results:       []ranker.ScoredEntry{},
+		}
+	}
+	return tabs
+}
+
+// startTabs starts each tab's ranker worker, then the source that feeds it.
+func (m Model) startTabs() {
+	for i, t := range m.tabs {
+		startRankerWorker(m.ctx, m.generation, i, t.ranker, t.rankerCmdChan, m.rankerResultChan)
+		pumpSource(m.ctx, t.source, t.rankerCmdChan)
 	}
 }
 
@@ -93,27 +294,200 @@ func debounceQueryCmd(query string, delay time.Duration) tea.Cmd {
 	})
 }
 
-func startRankerWorker(r *ranker.Ranker, cmdChan chan RankerCmd, resultChan chan ResultsUpdateMsg) {
+func startRankerWorker(ctx context.Context, generation int, tabIndex int, r *ranker.Ranker, cmdChan chan RankerCmd, resultChan chan ResultsUpdateMsg) {
 	go func() {
-		for cmd := range cmdChan {
-			if cmd.AddEntryBatch != nil {
-				// Score batch and insert into heap, then send updated results
-				r.AddEntryBatch(cmd.AddEntryBatch)
-				resultChan <- ResultsUpdateMsg{results: r.Results()}
+		// index is only kept once browse mode needs it, as it costs as
+		// much memory again as the entries
+		var index *dirIndex
+		for {
+			var cmd RankerCmd
+			select {
+			case cmd = <-cmdChan:
+			case <-ctx.Done():
+				return
+			}
+			// Apply whatever was already queued before publishing, so a fast
+			// source doesn't trigger a full re-sort for every batch
+			done := false
+			apply := func(cmd RankerCmd) {
+				if cmd.Index != nil && index == nil {
+					index = cmd.Index
+					index.fill(r.Entries())
+				}
+				if cmd.AddEntryBatch != nil {
+					r.AddEntryBatch(cmd.AddEntryBatch)
+					if index != nil {
+						index.add(cmd.AddEntryBatch)
+					}
+				}
+				if cmd.SetQuery != nil {
+					r.SetQuery(*cmd.SetQuery)
+				}
+				if cmd.SetTypes != nil {
+					r.SetTypes(cmd.SetTypes)
+				}
+				if cmd.SetSort != "" {
+					r.SetSort(cmd.SetSort)
+				}
+				if cmd.RemovePaths != nil {
+					r.Remove(cmd.RemovePaths...)
+					if index != nil {
+						index.remove(cmd.RemovePaths...)
+					}
+				}
+				if cmd.RenameFrom != "" {
+					r.Rename(cmd.RenameFrom, cmd.RenameTo)
+					if index != nil {
+						index.rename(cmd.RenameFrom, cmd.RenameTo)
+					}
+				}
+				done = done || cmd.Done
 			}
-			if cmd.SetQuery != nil {
-				// Rescore everything with new query, then send complete results
-				r.SetQuery(*cmd.SetQuery)
-				resultChan <- ResultsUpdateMsg{results: r.Results()}
+			apply(cmd)
+			// Bounded by the queue length at this point, so results still get
+			// published while a source keeps the queue full
+			for n := len(cmdChan); n > 0; n-- {
+				apply(<-cmdChan)
+			}
+			msg := ResultsUpdateMsg{generation: generation, tab: tabIndex, results: r.Top(maxResults), matches: r.Matches(), done: done}
+			select {
+			case resultChan <- msg:
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
-func batchFlushCmd() tea.Cmd {
-	return tea.Tick(50*time.Millisecond, func(t time.Time) tea.Msg {
-		return struct{ flush bool }{flush: true}
-	})
+// pumpSource runs src and forwards its entries to the ranker worker in
+// batches until the source is exhausted or ctx is cancelled, then its
+// changes when it is live.
+func pumpSource(ctx context.Context, src source.Source, cmdChan chan RankerCmd) {
+	entries := make(chan *entry.PathEntry, 1000)
+	go src.Entries(ctx, entries)
+
+	go func() {
+		batch := make([]*entry.PathEntry, 0, batchSize)
+		ticker := time.NewTicker(batchInterval)
+		defer ticker.Stop()
+		flush := func(done bool) {
+			if len(batch) == 0 && !done {
+				return
+			}
+			select {
+			case cmdChan <- RankerCmd{AddEntryBatch: batch, Done: done}:
+			case <-ctx.Done():
+			}
+			batch = make([]*entry.PathEntry, 0, batchSize)
+		}
+		for {
+			select {
+			case e, ok := <-entries:
+				if !ok {
+					flush(true)
+					if live, ok := src.(source.Live); ok {
+						followSource(ctx, live, cmdChan)
+					}
+					return
+				}
+				batch = append(batch, e)
+				if len(batch) >= batchSize {
+					flush(false)
+				}
+			case <-ticker.C:
+				flush(false)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// followSource forwards the changes of a live source to the ranker worker
+// until ctx is cancelled. Additions and removals are batched like
+// entries, in the order they happened.
+func followSource(ctx context.Context, live source.Live, cmdChan chan RankerCmd) {
+	changes := make(chan source.Change, 1000)
+	go live.Watch(ctx, changes)
+
+	var added []*entry.PathEntry
+	var removed []string
+	// tick is only set while something waits to be sent, so an idle
+	// picker isn't woken up
+	var tick <-chan time.Time
+	send := func(cmd RankerCmd) {
+		select {
+		case cmdChan <- cmd:
+		case <-ctx.Done():
+		}
+	}
+	flush := func() {
+		if len(added) > 0 {
+			send(RankerCmd{AddEntryBatch: added})
+			added = nil
+		}
+		if len(removed) > 0 {
+			send(RankerCmd{RemovePaths: removed})
+			removed = nil
+		}
+		tick = nil
+	}
+	for {
+		select {
+		case c, ok := <-changes:
+			if !ok {
+				flush()
+				return
+			}
+			switch {
+			case c.From == "":
+				if len(removed) > 0 {
+					flush()
+				}
+				added = append(added, c.Entry)
+			case c.To == "":
+				if len(added) > 0 {
+					flush()
+				}
+				removed = append(removed, c.From)
+			default:
+				flush()
+				send(RankerCmd{RenameFrom: c.From, RenameTo: c.To})
+			}
+			if len(added)+len(removed) >= batchSize {
+				flush()
+			} else if tick == nil && len(added)+len(removed) > 0 {
+				tick = time.After(batchInterval)
+			}
+		case <-tick:
+			flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setQueryCmd asks a tab's ranker to rescore for query. It sends from a
+// command rather than from Update so a busy worker never blocks the UI.
+func setQueryCmd(ctx context.Context, query string, cmdChan chan RankerCmd) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case cmdChan <- RankerCmd{SetQuery: &query}:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+}
+
+// sendRankerCmd sends cmd to a tab's ranker from a command.
+func sendRankerCmd(ctx context.Context, cmd RankerCmd, cmdChan chan RankerCmd) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case cmdChan <- cmd:
+		case <-ctx.Done():
+		}
+		return nil
+	}
 }
 
 func waitForRankerResult(resultChan chan ResultsUpdateMsg) tea.Cmd {
@@ -126,43 +500,89 @@ func (m Model) Selected() string {
 	return m.selected
 }
 
-func (m *Model) AddEntry(e *entry.PathEntry) {
-	m.mu.Lock()
-	m.ranker.AddEntry(e)
-	m.mu.Unlock()
-}
-
 func (m Model) Init() tea.Cmd {
-	// Start the ranker worker goroutine
-	startRankerWorker(m.ranker, m.rankerCmdChan, m.rankerResultChan)
+	m.startTabs()
 
-	// Start blinking cursor and batch flushing
-	// Don't wait for results yet - we'll start listening when we send the first command
-	return tea.Batch(
+	cmds := []tea.Cmd{
 		textinput.Blink,
-		batchFlushCmd(),
-	)
+		m.spinner.Tick,
+		waitForRankerResult(m.rankerResultChan),
+	}
+	// Apply an initial query right away instead of waiting for a keystroke
+	if m.pendingQuery != "" {
+		cmds = append(cmds, debounceQueryCmd(m.pendingQuery, 0))
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m Model) quit() (tea.Model, tea.Cmd) {
+	m.quitting = true
+	m.cancel()
+	return m, tea.Quit
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(gitResolvedMsg); ok {
+		m.gitPending = false
+	}
+	model, cmd := m.update(msg)
+	// Whatever changed, the rows now on screen may need their git badges
+	if m, ok := model.(Model); ok {
+		if git := m.resolveGit(); git != nil {
+			return m, tea.Batch(cmd, git)
+		}
+	}
+	return model, cmd
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.confirm != nil {
+			return m.updateConfirm(msg)
+		}
+		if m.prompting {
+			return m.updatePrompt(msg)
+		}
+		if m.showFailures {
+			return m.updateFailures(msg)
+		}
+		// Bound actions take precedence over the built-in keys
+		if a, ok := m.bindings[msg.String()]; ok {
+			return m.runAction(a)
+		}
 		switch msg.String() {
 		case "ctrl+c", "esc":
-			m.quitting = true
 			m.selected = ""
-			return m, tea.Quit
+			return m.quit()
 
 		case "enter":
-			if len(m.results) > 0 && m.cursor < len(m.results) {
-				m.selected = m.results[m.cursor].Entry.AbsPath
-				if m.results[m.cursor].Entry.FType == entry.FileTypeFile {
-					m.selected = filepath.Dir(m.results[m.cursor].Entry.AbsPath)
+			// Files are returned as-is; the cd function moves to their parent
+			// while the keybinding widgets insert the file itself
+			if m.cursor < m.rowCount() {
+				m.selected = m.row(m.cursor).Entry.AbsPath()
+				// Entries in archives only exist once extracted
+				if archive.Inside(m.selected) {
+					m.confirmExtract(m.selected)
+					m.selected = ""
+					return m, nil
 				}
 			}
-			m.quitting = true
-			return m, tea.Quit
+			return m.quit()
+
+		case "ctrl+l":
+			return m.toggleBrowse()
+		case "alt+t":
+			return m.toggleTree()
+		case "left":
+			if m.browsing {
+				return m.browseUp()
+			}
+		case "right":
+			if m.browsing {
+				return m.browseInto()
+			}
 
 		case "up", "ctrl+p":
 			if m.cursor > 0 {
@@ -173,65 +593,147 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		case "down", "ctrl+n":
-			if m.cursor < len(m.results)-1 {
+			if m.cursor < m.rowCount()-1 {
 				m.cursor++
-				if m.cursor >= m.viewportOffset+m.maxVisibleResult {
-					m.viewportOffset = m.cursor - (m.maxVisibleResult) + 1
+				if m.cursor >= m.viewportOffset+m.visibleRows() {
+					m.viewportOffset = m.cursor - m.visibleRows() + 1
 				}
 			}
 			return m, nil
-		}
 
-	case EntryMsg:
-		// Batch entries instead of sending one at a time
-		m.entryBatch = append(m.entryBatch, msg)
-		// If batch is large enough, flush immediately
-		if len(m.entryBatch) >= 100 {
-			batch := m.entryBatch
-			m.entryBatch = make([]*entry.PathEntry, 0, 100)
-			select {
-			case m.rankerCmdChan <- RankerCmd{AddEntryBatch: batch}:
-				// Sent batch, wait for results
-				return m, waitForRankerResult(m.rankerResultChan)
-			default:
-				// Channel full, skip this batch
+		case "tab":
+			m.switchTab(1)
+			return m, nil
+		case "shift+tab":
+			m.switchTab(-1)
+			return m, nil
+
+		case "ctrl+o":
+			return m.reroot(filepath.Dir(m.baseDir))
+		case "ctrl+t":
+			return m.rerootUnderCursor()
+		case "alt+h":
+			return m.rerootHome()
+		case "alt+g":
+			return m.rerootRepo()
+
+		case "alt+d":
+			return m.toggleType(entry.FileTypeDir)
+		case "alt+f":
+			return m.toggleType(entry.FileTypeFile)
+		case "alt+l":
+			return m.toggleType(entry.FileTypeSymlink)
+		case "alt+s":
+			return m.cycleSort()
+		case "alt+w":
+			m.explaining = !m.explaining
+			m.clampViewport()
+			return m, nil
+
+		case "alt+e":
+			if _, ok := m.reporter(); ok {
+				m.showFailures = true
+				m.failuresOffset = 0
 			}
+			return m, nil
+
+		case "alt+n":
+			return m, m.startMkdirPrompt()
+		case "alt+r":
+			return m, m.startRenamePrompt()
+		case "alt+x":
+			m.confirmTrash()
+			return m, nil
+
+		case "ctrl+b":
+			return m, m.startBookmarkPrompt()
+		case "ctrl+x":
+			return m, m.removeBookmarkUnderCursor()
 		}
-		return m, nil
 
-	case CrawlDoneMsg:
-		// Trigger a final query to score all collected entries
-		query := m.textInput.Value()
-		m.rankerCmdChan <- RankerCmd{SetQuery: &query}
+	case fileOpMsg:
+		return m.fileOpDone(msg)
+
+	case actionDoneMsg:
+		return m.actionDone(msg)
+
+	case spinner.TickMsg:
+		return m.updateSpinner(msg)
+
+	case bookmarksMsg:
+		if msg.err != nil {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		m.status = ""
+		m.setBookmarks(msg.bookmarks)
 		return m, nil
 
 	case QueryUpdateMsg:
 		// Only update if this query is still pending (user hasn't typed more)
 		if msg.query == m.textInput.Value() {
-			query := msg.query
-			// Send query to ranker worker (non-blocking)
-			// Worker will score and send back complete results
-			select {
-			case m.rankerCmdChan <- RankerCmd{SetQuery: &query}:
-				// Sent query, wait for results
-				m.activeQuery = msg.query
+			if msg.query != m.activeQuery {
 				m.cursor = 0
 				m.viewportOffset = 0
-				return m, waitForRankerResult(m.rankerResultChan)
-			default:
 			}
 			m.activeQuery = msg.query
-			m.cursor = 0
-			m.viewportOffset = 0
+			m.refreshPinned()
+			// Workers will rescore every tab and send back complete results
+			cmds := make([]tea.Cmd, 0, len(m.tabs)+1)
+			for _, t := range m.tabs {
+				cmds = append(cmds, setQueryCmd(m.ctx, msg.query, t.rankerCmdChan))
+			}
+			if m.browsing {
+				cmds = append(cmds, m.refreshBrowse())
+			}
+			return m, tea.Batch(cmds...)
 		}
 		return m, nil
 
 	case ResultsUpdateMsg:
 		// Received complete results from ranker worker
-		m.results = msg.results
+		if msg.generation != m.generation {
+			return m, waitForRankerResult(m.rankerResultChan)
+		}
+		m.tabs[msg.tab].results = msg.results
+		m.tabs[msg.tab].rows = msg.results
+		m.tabs[msg.tab].matches = msg.matches
+		if msg.tab == 0 {
+			m.unpin()
+		}
+		m.tabs[msg.tab].done = m.tabs[msg.tab].done || msg.done
+		if msg.tab == m.activeTab {
+			m.rebuildTree()
+		}
 		m.clampCursor()
 		// Keep listening for more results
-		return m, waitForRankerResult(m.rankerResultChan)
+		cmds := []tea.Cmd{waitForRankerResult(m.rankerResultChan)}
+		if m.tabs[msg.tab].source.Name() == source.NameCrawl {
+			if msg.done {
+				m.index.setCrawled()
+			}
+			// The crawl may have reached the browsed directory meanwhile
+			if m.browsing {
+				cmds = append(cmds, m.refreshBrowse())
+			}
+		}
+		return m, tea.Batch(cmds...)
+
+	case dirListingMsg:
+		if msg.generation != m.generation {
+			return m, nil
+		}
+		m.index.setListing(msg.dir, msg.entries)
+		if msg.err != nil {
+			m.status = msg.err.Error()
+		}
+		if m.browseLoading == msg.dir {
+			m.browseLoading = ""
+		}
+		if m.browsing {
+			return m, m.refreshBrowse()
+		}
+		return m, nil
 
 	case tea.WindowSizeMsg:
 		m.windowHeight = msg.Height
@@ -240,28 +742,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.safeWidth = m.windowWidth - horizontalMargin
 		m.textInput.Width = m.safeWidth
 		if m.safeWidth < 10 || m.maxVisibleResult <= 0 {
-			m.quitting = true
 			m.selected = ""
-			return m, tea.Quit
+			return m.quit()
 		}
 		return m, tea.ClearScreen
-
-	default:
-		// Check if this is a batch flush message
-		if flushMsg, ok := msg.(struct{ flush bool }); ok && flushMsg.flush {
-			// Flush pending batch
-			if len(m.entryBatch) > 0 {
-				batch := m.entryBatch
-				m.entryBatch = make([]*entry.PathEntry, 0, 100)
-				select {
-				case m.rankerCmdChan <- RankerCmd{AddEntryBatch: batch}:
-					// Sent batch, wait for results
-					return m, tea.Batch(batchFlushCmd(), waitForRankerResult(m.rankerResultChan))
-				default:
-				}
-			}
-			return m, batchFlushCmd()
-		}
 	}
 
 	prevValue := m.textInput.Value()
@@ -275,9 +759,76 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// switchTab moves delta tabs to the right, wrapping around.
+func (m *Model) switchTab(delta int) {
+	if len(m.tabs) < 2 || m.browsing {
+		return
+	}
+	m.activeTab = (m.activeTab + delta + len(m.tabs)) % len(m.tabs)
+	m.cursor = 0
+	m.viewportOffset = 0
+	m.rebuildTree()
+}
+
+// results returns the active tab's ranked results, or the browsed
+// directory's entries in browse mode.
+func (m Model) results() []ranker.ScoredEntry {
+	if m.browsing {
+		return m.browseRows
+	}
+	if len(m.tabs) == 0 {
+		return nil
+	}
+	return m.tabs[m.activeTab].rows
+}
+
+// matchCount returns how many results there are, listed or not.
+func (m Model) matchCount() int {
+	if m.browsing || len(m.tabs) == 0 {
+		return len(m.results())
+	}
+	t := m.tabs[m.activeTab]
+	// Less the pinned bookmarks left out of the rows
+	return t.matches - (len(t.results) - len(t.rows))
+}
+
+// pinnedRows returns the pinned bookmarks, which only the first tab shows.
+func (m Model) pinnedRows() []ranker.ScoredEntry {
+	if m.activeTab != 0 || m.browsing {
+		return nil
+	}
+	return m.pinned
+}
+
+// treeActive reports whether results are shown in the tree layout.
+func (m Model) treeActive() bool {
+	return m.treeView && !m.browsing
+}
+
+// rowCount returns the number of selectable rows: pinned bookmarks
+// followed by the ranked results, or by the tree rows.
+func (m Model) rowCount() int {
+	if m.treeActive() {
+		return len(m.pinnedRows()) + len(m.treeRows)
+	}
+	return len(m.pinnedRows()) + len(m.results())
+}
+
+// row returns the i-th selectable row.
+func (m Model) row(i int) ranker.ScoredEntry {
+	pinned := m.pinnedRows()
+	if i < len(pinned) {
+		return pinned[i]
+	}
+	if m.treeActive() {
+		return m.treeRows[i-len(pinned)].result
+	}
+	return m.results()[i-len(pinned)]
+}
+
 func (m *Model) clampCursor() {
-	if m.cursor >= len(m.results) {
-		m.cursor = len(m.results) - 1
+	if m.cursor >= m.rowCount() {
+		m.cursor = m.rowCount() - 1
 	}
 	if m.cursor < 0 {
 		m.cursor = 0
@@ -296,39 +847,199 @@ func (m Model) View() string {
 	b.WriteString(m.textInput.View())
 	b.WriteString("\n\n")
 
-	total := len(m.results)
-	b.WriteString(fmt.Sprintf("	%d results\n", total))
+	if m.showFailures {
+		b.WriteString(m.failuresView())
+		return b.String()
+	}
+
+	activeTabStyle := lipgloss.NewStyle().Bold(true).Reverse(true)
+	originStyle := lipgloss.NewStyle().Faint(true)
+
+	// Tab bar, only worth showing when there is more than one source. Browse
+	// mode shows the browsed directory instead
+	showOrigin := len(m.tabs) > 1 && !m.browsing
+	if m.browsing {
+		b.WriteString(fmt.Sprintf(" browse: %s\n", m.browseDir))
+	} else if showOrigin {
+		b.WriteString(" ")
+		for i, t := range m.tabs {
+			label := fmt.Sprintf(" %s (%d) ", t.source.Name(), t.matches)
+			if !t.done {
+				label = fmt.Sprintf(" %s (%d…) ", t.source.Name(), t.matches)
+			}
+			if i == m.activeTab {
+				label = activeTabStyle.Render(label)
+			}
+			b.WriteString(label)
+		}
+		b.WriteString("\n")
+	}
+
+	total, listed := m.matchCount(), len(m.results())
+	summary := fmt.Sprintf("%d results", total)
+	if m.treeActive() && listed > maxTreeResults {
+		summary += fmt.Sprintf(", best %d shown as a tree", maxTreeResults)
+	} else if listed < total {
+		summary += fmt.Sprintf(", best %d listed", listed)
+	} else if pinned := len(m.pinnedRows()); pinned > 0 {
+		summary += fmt.Sprintf(", %d pinned", pinned)
+	}
+	if label, filtered := m.typesLabel(); filtered {
+		summary += ", types: " + label
+	}
+	if m.sortMode != ranker.SortScore {
+		summary += ", sorted by " + string(m.sortMode)
+	}
+	b.WriteString("	" + summary + "\n")
 	b.WriteString(strings.Repeat("-", m.safeWidth) + "\n")
 
-	end := m.viewportOffset + m.maxVisibleResult
-	if end > len(m.results) {
-		end = len(m.results)
+	end := m.viewportOffset + m.visibleRows()
+	if end > m.rowCount() {
+		end = m.rowCount()
 	}
-	visible := m.results[m.viewportOffset:end]
 
-	highlightStyle := lipgloss.NewStyle().Background(lipgloss.Color("22"))
+	highlightStyle := lipgloss.NewStyle().Background(lipgloss.Color(m.theme.Cursor))
+	bookmarkStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(m.theme.Bookmark))
+	matchStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(m.theme.Match))
+	projectStyle := lipgloss.NewStyle().Foreground(lipgloss.Color(m.theme.Project))
+	ancestorStyle := lipgloss.NewStyle().Faint(true)
+	pinnedCount := len(m.pinnedRows())
+	cols := m.visibleColumns()
 
-	for i, res := range visible {
+	for i := m.viewportOffset; i < end; i++ {
+		res := m.row(i)
 		cursor := "  "
-		displayPath := res.Entry.AbsPath
+		displayPath := res.Entry.AbsPath()
+		if m.browsing {
+			displayPath = filepath.Base(displayPath)
+			if res.Entry.FType == entry.FileTypeDir {
+				displayPath += "/"
+			}
+		}
+
+		// Tag each row with the source it came from
+		origin := ""
+		if showOrigin {
+			origin = fmt.Sprintf("%-10s", res.Entry.Origin)
+		}
+
+		// Bookmarks are marked wherever they appear, pinned or not
+		label := ""
+		if names, ok := m.bookmarkNames[res.Entry.AbsPath()]; ok {
+			label = "★ " + strings.Join(names, ", ") + "  "
+		}
+
+		// In the tree layout, branch lines come before the label, matched
+		// nodes stand out and ancestors shown for context are dimmed
+		var tree *treeRow
+		if m.treeActive() && i >= pinnedCount {
+			tree = &m.treeRows[i-pinnedCount]
+			displayPath = tree.label
+		}
+
+		indicator := cells(cols, res.Entry) + typeIndicator(res.Entry.FType) + " "
+		badge := gitBadge(res.Entry)
+		kind := projectBadge(res.Entry)
 
-		if len(displayPath) > m.safeWidth {
-			displayPath = "..." + displayPath[len(displayPath)-m.safeWidth+3:]
+		width := m.safeWidth - len(label) - len(origin) - len(indicator) - lipgloss.Width(badge) - len(kind)
+		if tree != nil {
+			width -= lipgloss.Width(tree.prefix)
+		}
+		if width > 3 && len(displayPath) > width {
+			displayPath = "..." + displayPath[len(displayPath)-width+3:]
 		}
 		line := displayPath
-		if i+m.viewportOffset == m.cursor {
+		if tree != nil {
+			if tree.matched {
+				line = matchStyle.Render(displayPath)
+			} else {
+				line = ancestorStyle.Render(displayPath)
+			}
+		}
+		if i == m.cursor {
 			cursor = "> "
 			line = highlightStyle.Render(displayPath)
 		}
+		if label != "" {
+			line = bookmarkStyle.Render(label) + line
+		}
+		if kind != "" {
+			line += projectStyle.Render(kind)
+		}
+		if badge != "" {
+			line += renderGitBadge(res.Entry, badge, m.theme)
+		}
+		line = originStyle.Render(indicator) + line
+		if tree != nil {
+			line = ancestorStyle.Render(tree.prefix) + line
+		}
+		if origin != "" {
+			line = originStyle.Render(origin) + line
+		}
 
 		b.WriteString(fmt.Sprintf("%s%s\n", cursor, line))
 	}
 
-	if len(m.results) > m.maxVisibleResult {
-		b.WriteString(fmt.Sprintf("\n	... and %d more\n", len(m.results)-m.maxVisibleResult))
+	if m.rowCount() > m.visibleRows() {
+		b.WriteString(fmt.Sprintf("\n	... and %d more\n", m.rowCount()-m.visibleRows()))
+	}
+
+	if m.explaining {
+		b.WriteString(m.explainView())
+	}
+
+	if bar := m.statusBarView(); bar != "" {
+		b.WriteString("\n")
+		b.WriteString(bar)
+	}
+
+	if m.prompting {
+		b.WriteString("\n ")
+		b.WriteString(m.namePrompt.View())
+		b.WriteString("\n")
+	}
+	if m.confirm != nil {
+		b.WriteString(fmt.Sprintf("\n %s\n", m.confirm.question))
+	}
+	if m.status != "" {
+		b.WriteString(fmt.Sprintf("\n %s\n", m.status))
 	}
 
-	b.WriteString("\n, ↑/↓: navigate • enter: select • esc: quit\n")
+	b.WriteString("\n")
+	b.WriteString(m.helpView())
 
 	return b.String()
 }
+
+// helpView lists the keys that apply in the current mode.
+func (m Model) helpView() string {
+	if m.confirm != nil {
+		return ", y: confirm • any other key: cancel\n"
+	}
+	if m.prompting {
+		return ", enter: " + m.promptKind.verb() + " • esc: cancel\n"
+	}
+	keys := []string{"↑/↓: navigate"}
+	if m.browsing {
+		keys = append(keys, "←/→: up/into", "enter: select", "ctrl+l: search")
+	} else {
+		if len(m.tabs) > 1 {
+			keys = append(keys, "tab: switch source")
+		}
+		keys = append(keys, "enter: select", "ctrl+l: browse", "alt+t: tree", "alt+d/f/l: types", "alt+s: sort", "alt+w: why")
+	}
+	keys = append(keys, "ctrl+b: bookmark", "ctrl+x: unbookmark", "alt+n: mkdir", "alt+r: rename", "alt+x: trash", "esc: quit")
+	help := ", " + strings.Join(keys, " • ") + "\n"
+
+	var more []string
+	for _, key := range m.bindings.Keys() {
+		more = append(more, key+": "+m.bindings[key].Name)
+	}
+	if m.newSources != nil {
+		more = append(more, "ctrl+o: parent", "ctrl+t: re-root here", "alt+h: home", "alt+g: repo root")
+	}
+	if len(more) > 0 {
+		help += ", " + strings.Join(more, " • ") + "\n"
+	}
+	return help
+}
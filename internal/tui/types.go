@@ -0,0 +1,66 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sakolb/bcd/internal/entry"
+)
+
+// allTypes lists every file type, in the order they are shown.
+var allTypes = []entry.FileType{entry.FileTypeDir, entry.FileTypeFile, entry.FileTypeSymlink}
+
+// typeIndicator is the one letter shown before each row.
+func typeIndicator(t entry.FileType) string {
+	switch t {
+	case entry.FileTypeDir:
+		return "d"
+	case entry.FileTypeSymlink:
+		return "l"
+	default:
+		return "f"
+	}
+}
+
+// toggleType shows or hides entries of type t in every tab. At least one
+// type always stays shown.
+func (m Model) toggleType(t entry.FileType) (tea.Model, tea.Cmd) {
+	types := make([]entry.FileType, 0, len(allTypes))
+	for _, at := range allTypes {
+		if (at == t) != slices.Contains(m.types, at) {
+			types = append(types, at)
+		}
+	}
+	if len(types) == 0 {
+		m.status = "at least one type must be shown"
+		return m, nil
+	}
+	m.types = types
+	m.status = ""
+	m.cursor = 0
+	m.viewportOffset = 0
+	m.refreshPinned()
+
+	cmds := make([]tea.Cmd, 0, len(m.tabs)+1)
+	for _, t := range m.tabs {
+		cmds = append(cmds, sendRankerCmd(m.ctx, RankerCmd{SetTypes: types}, t.rankerCmdChan))
+	}
+	if m.browsing {
+		cmds = append(cmds, m.refreshBrowse())
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// typesLabel describes the types shown, and reports whether some are
+// hidden.
+func (m Model) typesLabel() (string, bool) {
+	if len(m.types) == len(allTypes) {
+		return "", false
+	}
+	letters := make([]string, len(m.types))
+	for i, t := range m.types {
+		letters[i] = typeIndicator(t)
+	}
+	return strings.Join(letters, ","), true
+}
@@ -0,0 +1,32 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sakolb/bcd/internal/entry"
+)
+
+func TestToggleType(t *testing.T) {
+	d, f, l := entry.FileTypeDir, entry.FileTypeFile, entry.FileTypeSymlink
+	for _, tt := range []struct {
+		start  []entry.FileType
+		toggle entry.FileType
+		want   []entry.FileType
+		status string
+	}{
+		{nil, f, []entry.FileType{d, l}, ""},
+		// Types hidden at start can be shown again
+		{[]entry.FileType{d}, f, []entry.FileType{d, f}, ""},
+		{[]entry.FileType{l, d}, f, []entry.FileType{d, f, l}, ""},
+		{[]entry.FileType{d, f}, d, []entry.FileType{f}, ""},
+		{[]entry.FileType{d}, d, []entry.FileType{d}, "at least one type must be shown"},
+	} {
+		m := InitModel("/", Options{Types: tt.start})
+		next, _ := m.toggleType(tt.toggle)
+		got := next.(Model)
+		if !slices.Equal(got.types, tt.want) || got.status != tt.status {
+			t.Errorf("%v toggling %v: got %v, %q, want %v, %q", tt.start, tt.toggle, got.types, got.status, tt.want, tt.status)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package vfs
+
+import "io/fs"
+
+// Operations passed to Faulty.Fault.
+const (
+	OpOpen    = "open"
+	OpLstat   = "lstat"
+	OpReadDir = "readdir"
+)
+
+// Faulty wraps an FS to fail or slow down some of its calls, to test how
+// those failures are handled.
+type Faulty struct {
+	FS FS
+	// Fault is called before each call on FS and on the directories it
+	// opens, with the operation and the path. The error it returns, if
+	// any, fails the call, as a *fs.PathError; it may also block to
+	// simulate slow I/O.
+	Fault func(op string, name string) error
+}
+
+func (f *Faulty) fault(op string, name string) error {
+	if err := f.Fault(op, name); err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return nil
+}
+
+func (f *Faulty) Open(name string) (fs.File, error) {
+	if err := f.fault(OpOpen, name); err != nil {
+		return nil, err
+	}
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if dir, ok := file.(fs.ReadDirFile); ok {
+		return &faultyDir{ReadDirFile: dir, faulty: f, name: name}, nil
+	}
+	return file, nil
+}
+
+func (f *Faulty) Lstat(name string) (fs.FileInfo, error) {
+	if err := f.fault(OpLstat, name); err != nil {
+		return nil, err
+	}
+	return f.FS.Lstat(name)
+}
+
+type faultyDir struct {
+	fs.ReadDirFile
+	faulty *Faulty
+	name   string
+}
+
+func (d *faultyDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if err := d.faulty.fault(OpReadDir, d.name); err != nil {
+		return nil, err
+	}
+	return d.ReadDirFile.ReadDir(n)
+}
@@ -0,0 +1,202 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Mem is an in-memory FS of directories, files and symbolic links, which
+// are never followed. It is safe for concurrent use.
+type Mem struct {
+	mu   sync.Mutex
+	root *memFile
+}
+
+type memFile struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+	// children are the entries of a directory, by name
+	children map[string]*memFile
+}
+
+// NewMem returns a Mem holding only the root directory.
+func NewMem() *Mem {
+	return &Mem{root: newMemDir("/")}
+}
+
+func newMemDir(name string) *memFile {
+	return &memFile{name: name, mode: fs.ModeDir | 0o755, children: make(map[string]*memFile)}
+}
+
+// Mkdir adds the directory at path, and its parents as needed.
+func (m *Mem) Mkdir(path string) {
+	m.add(path, newMemDir(""))
+}
+
+// WriteFile adds a file at path holding data, and its parents as needed.
+func (m *Mem) WriteFile(path string, data []byte) {
+	m.add(path, &memFile{mode: 0o644, data: data})
+}
+
+// Symlink adds a symbolic link at path, and its parents as needed.
+func (m *Mem) Symlink(path string) {
+	m.add(path, &memFile{mode: fs.ModeSymlink | 0o777})
+}
+
+// Chtimes sets the modification time of path.
+func (m *Mem) Chtimes(path string, modTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f := m.lookup(path); f != nil {
+		f.modTime = modTime
+	}
+}
+
+// Remove removes path and everything below it.
+func (m *Mem) Remove(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dir := m.lookup(filepath.Dir(path)); dir != nil && dir.children != nil {
+		delete(dir.children, filepath.Base(path))
+	}
+}
+
+// add puts f at path, replacing what was there but a directory with
+// another, with its parents made directories as needed.
+func (m *Mem) add(path string, f *memFile) {
+	path = filepath.Clean(path)
+	if path == "/" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir := m.root
+	for _, name := range strings.Split(strings.Trim(filepath.Dir(path), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		child := dir.children[name]
+		if child == nil || child.children == nil {
+			child = newMemDir(name)
+			dir.children[name] = child
+		}
+		dir = child
+	}
+	f.name = filepath.Base(path)
+	if old := dir.children[f.name]; old != nil && old.children != nil && f.children != nil {
+		return
+	}
+	dir.children[f.name] = f
+}
+
+// lookup returns the file at path, or nil.
+func (m *Mem) lookup(path string) *memFile {
+	f := m.root
+	for _, name := range strings.Split(strings.Trim(filepath.Clean(path), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		if f = f.children[name]; f == nil {
+			return nil
+		}
+	}
+	return f
+}
+
+func (m *Mem) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.lookup(name)
+	if f == nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return f.info(), nil
+}
+
+func (m *Mem) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.lookup(name)
+	switch {
+	case f == nil, f.mode&fs.ModeSymlink != 0:
+		// Links lead nowhere
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !f.mode.IsDir():
+		return &memReader{info: f.info(), Reader: bytes.NewReader(f.data)}, nil
+	}
+
+	// The listing is taken when opened, as os.ReadDir might have it
+	children := make([]fs.DirEntry, 0, len(f.children))
+	for _, c := range f.children {
+		children = append(children, c.info())
+	}
+	slices.SortFunc(children, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return &memDir{info: f.info(), path: name, children: children}, nil
+}
+
+// info returns a copy of f, which later changes do not affect.
+func (f *memFile) info() *memFile {
+	info := *f
+	info.children = nil
+	return &info
+}
+
+// memFile is its own FileInfo and DirEntry.
+
+func (f *memFile) Name() string               { return f.name }
+func (f *memFile) Size() int64                { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode          { return f.mode }
+func (f *memFile) ModTime() time.Time         { return f.modTime }
+func (f *memFile) IsDir() bool                { return f.mode.IsDir() }
+func (f *memFile) Sys() any                   { return nil }
+func (f *memFile) Type() fs.FileMode          { return f.mode.Type() }
+func (f *memFile) Info() (fs.FileInfo, error) { return f, nil }
+
+// memReader is an open file. It is an io.ReaderAt, as zip archives need.
+type memReader struct {
+	info *memFile
+	*bytes.Reader
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+// memDir is an open directory.
+type memDir struct {
+	info     *memFile
+	path     string
+	children []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: syscall.EISDIR}
+}
+
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		children := d.children
+		d.children = nil
+		return children, nil
+	}
+	if len(d.children) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.children))
+	children := d.children[:n]
+	d.children = d.children[n:]
+	return children, nil
+}
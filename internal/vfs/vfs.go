@@ -0,0 +1,45 @@
+// Package vfs is the filesystem the crawl and entries read through: the
+// disk, or another backend such as the in-memory one tests use.
+package vfs
+
+import (
+	"io/fs"
+	"os"
+)
+
+// FS is a filesystem, in the style of io/fs but over absolute paths, as
+// the crawl goes up to "/".
+type FS interface {
+	// Open opens the file at name for reading. A directory opened
+	// implements fs.ReadDirFile.
+	Open(name string) (fs.File, error)
+	// Lstat returns the FileInfo of the file at name, without following
+	// a symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// OS is the operating system's filesystem.
+var OS FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	// An *os.File in an fs.File holding nil would not be nil
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// Or returns fsys, or OS when it is nil.
+func Or(fsys FS) FS {
+	if fsys == nil {
+		return OS
+	}
+	return fsys
+}
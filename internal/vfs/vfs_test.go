@@ -0,0 +1,113 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"testing"
+)
+
+// names lists the directory at path in fsys.
+func names(t *testing.T, fsys FS, path string) []string {
+	t.Helper()
+	f, err := fsys.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := f.(fs.ReadDirFile).ReadDir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestMem(t *testing.T) {
+	mem := NewMem()
+	mem.WriteFile("/src/b/main.go", []byte("package main"))
+	mem.Mkdir("/src/a")
+	mem.Symlink("/src/c")
+	mem.Mkdir("/src")
+
+	if got := names(t, mem, "/src"); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected listing %q", got)
+	}
+	for path, mode := range map[string]fs.FileMode{"/src": fs.ModeDir, "/src/b/main.go": 0, "/src/c": fs.ModeSymlink} {
+		fi, err := mem.Lstat(path)
+		if err != nil || fi.Mode().Type() != mode {
+			t.Errorf("Lstat(%s) = %v, %v", path, fi, err)
+		}
+	}
+
+	f, err := mem.Open("/src/b/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil || string(data) != "package main" {
+		t.Errorf("read %q, %v", data, err)
+	}
+
+	if _, err := mem.Open("/src/c"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected links not to be followed, got %v", err)
+	}
+	mem.Remove("/src/b")
+	if _, err := mem.Lstat("/src/b/main.go"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v, got %v", fs.ErrNotExist, err)
+	}
+}
+
+func TestMemReadDirPages(t *testing.T) {
+	mem := NewMem()
+	for _, name := range []string{"/d/1", "/d/2", "/d/3"} {
+		mem.WriteFile(name, nil)
+	}
+	f, _ := mem.Open("/d")
+	dir := f.(fs.ReadDirFile)
+	var got []string
+	for {
+		entries, err := dir.ReadDir(2)
+		if err == io.EOF {
+			break
+		}
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+	}
+	if !slices.Equal(got, []string{"1", "2", "3"}) {
+		t.Errorf("unexpected pages %q", got)
+	}
+}
+
+func TestFaulty(t *testing.T) {
+	mem := NewMem()
+	mem.WriteFile("/d/f", nil)
+	var calls []string
+	faulty := &Faulty{FS: mem, Fault: func(op string, name string) error {
+		calls = append(calls, op+" "+name)
+		if op == OpReadDir {
+			return fs.ErrPermission
+		}
+		return nil
+	}}
+	if _, err := faulty.Lstat("/d/f"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	f, err := faulty.Open("/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.(fs.ReadDirFile).ReadDir(-1)
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Op != OpReadDir || pathErr.Path != "/d" || !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if want := []string{"lstat /d/f", "open /d", "readdir /d"}; !slices.Equal(calls, want) {
+		t.Errorf("calls %q, want %q", calls, want)
+	}
+}
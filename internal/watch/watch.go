@@ -0,0 +1,261 @@
+// Package watch reports the entries created, removed and renamed in a set
+// of directories, using inotify. Only the directories added are watched,
+// not their subdirectories: callers add those as they learn about them.
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoSpace is returned by Add, wrapped, once the user's inotify watches
+// run out.
+var ErrNoSpace = errors.New("inotify watch limit reached (see /proc/sys/fs/inotify/max_user_watches)")
+
+// Op is what happened to an entry.
+type Op int
+
+const (
+	Create Op = iota + 1
+	Remove
+	// Rename moved an entry within the watched directories, from OldPath
+	Rename
+	// Overflow means events were lost: whatever was watched must be read
+	// again. Its Path is empty.
+	Overflow
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Remove:
+		return "remove"
+	case Rename:
+		return "rename"
+	case Overflow:
+		return "overflow"
+	}
+	return "unknown"
+}
+
+// Event is a change to an entry of a watched directory.
+type Event struct {
+	Op   Op
+	Path string
+	// OldPath is where a renamed entry was
+	OldPath string
+	Dir     bool
+}
+
+const mask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_DELETE_SELF | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// Watcher watches directories for changes to their entries.
+type Watcher struct {
+	f      *os.File
+	events chan Event
+	errs   chan error
+	done   chan struct{}
+
+	mu    sync.Mutex
+	paths map[int]string
+	wds   map[string]int
+}
+
+// New starts a Watcher with no directories.
+func New() (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &Watcher{
+		// A non-blocking descriptor goes through the runtime's poller, so
+		// Close interrupts a pending Read
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan Event, 256),
+		errs:   make(chan error, 1),
+		done:   make(chan struct{}),
+		paths:  make(map[int]string),
+		wds:    make(map[string]int),
+	}
+	go w.read()
+	return w, nil
+}
+
+// Events delivers the changes, in the order they happened. It is closed
+// once the Watcher is.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors delivers the error that stopped the Watcher, if any.
+func (w *Watcher) Errors() <-chan error {
+	return w.errs
+}
+
+// Add watches dir. Adding a directory twice is harmless.
+func (w *Watcher) Add(dir string) error {
+	wd, err := unix.InotifyAddWatch(int(w.f.Fd()), dir, mask)
+	if err == unix.ENOSPC {
+		return &os.PathError{Op: "watch", Path: dir, Err: ErrNoSpace}
+	}
+	if err != nil {
+		return &os.PathError{Op: "watch", Path: dir, Err: err}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if old, ok := w.paths[wd]; ok && old != dir {
+		delete(w.wds, old)
+	}
+	w.paths[wd] = dir
+	w.wds[dir] = wd
+	return nil
+}
+
+// Remove stops watching dir and the directories under it.
+func (w *Watcher) Remove(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, wd := range w.wds {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			unix.InotifyRmWatch(int(w.f.Fd()), uint32(wd))
+			delete(w.wds, path)
+			delete(w.paths, wd)
+		}
+	}
+}
+
+// Len returns the number of directories watched.
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.wds)
+}
+
+// Close stops watching. Events is closed once pending events are dropped.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+		return nil
+	default:
+	}
+	close(w.done)
+	return w.f.Close()
+}
+
+func (w *Watcher) read() {
+	defer close(w.events)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.errs <- err
+			}
+			return
+		}
+		for _, e := range w.parse(buf[:n]) {
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// parse turns a buffer of raw inotify events into Events. A move within
+// the watched directories shows up as IN_MOVED_FROM directly followed by
+// IN_MOVED_TO with the same cookie, and becomes a single Rename; the
+// halves of a move in or out of them become a Create or a Remove.
+func (w *Watcher) parse(buf []byte) []Event {
+	var events []Event
+	var moved *Event
+	var cookie uint32
+	flushMove := func() {
+		if moved != nil {
+			events = append(events, *moved)
+			moved = nil
+		}
+	}
+
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+		nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(raw.Len)]
+		off += unix.SizeofInotifyEvent + int(raw.Len)
+		name := strings.TrimRight(string(nameBytes), "\x00")
+
+		if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+			flushMove()
+			events = append(events, Event{Op: Overflow})
+			continue
+		}
+		w.mu.Lock()
+		dir, ok := w.paths[int(raw.Wd)]
+		if raw.Mask&unix.IN_IGNORED != 0 && ok {
+			delete(w.paths, int(raw.Wd))
+			if w.wds[dir] == int(raw.Wd) {
+				delete(w.wds, dir)
+			}
+		}
+		w.mu.Unlock()
+		if !ok || name == "" {
+			// The watched directory itself went away; its parent reports it
+			continue
+		}
+		e := Event{Path: filepath.Join(dir, name), Dir: raw.Mask&unix.IN_ISDIR != 0}
+
+		switch {
+		case raw.Mask&unix.IN_MOVED_TO != 0 && moved != nil && raw.Cookie == cookie:
+			e.Op = Rename
+			e.OldPath = moved.Path
+			moved = nil
+			if e.Dir {
+				w.renamed(e.OldPath, e.Path)
+			}
+			events = append(events, e)
+		case raw.Mask&unix.IN_MOVED_FROM != 0:
+			flushMove()
+			e.Op = Remove
+			moved, cookie = &e, raw.Cookie
+		case raw.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			flushMove()
+			e.Op = Create
+			events = append(events, e)
+		case raw.Mask&unix.IN_DELETE != 0:
+			flushMove()
+			e.Op = Remove
+			events = append(events, e)
+		}
+	}
+	flushMove()
+	return events
+}
+
+// renamed moves the watches under oldDir to newDir: inotify follows the
+// directories, but only knows them by descriptor.
+func (w *Watcher) renamed(oldDir, newDir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	moved := make(map[string]int)
+	for path, wd := range w.wds {
+		rel, ok := strings.CutPrefix(path, oldDir)
+		if ok && (rel == "" || rel[0] == '/') {
+			moved[newDir+rel] = wd
+			delete(w.wds, path)
+		}
+	}
+	for path, wd := range moved {
+		w.wds[path] = wd
+		w.paths[wd] = path
+	}
+}
@@ -0,0 +1,98 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// next returns the next event, failing the test if none comes in time.
+func next(t *testing.T, w *Watcher) Event {
+	t.Helper()
+	select {
+	case e := <-w.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(root, "build")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, w); e != (Event{Op: Create, Path: dir, Dir: true}) {
+		t.Errorf("mkdir: got %+v", e)
+	}
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := filepath.Join(root, "out")
+	if err := os.Rename(dir, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, w); e != (Event{Op: Rename, Path: renamed, OldPath: dir, Dir: true}) {
+		t.Errorf("rename: got %+v", e)
+	}
+
+	// The watch follows the renamed directory
+	file := filepath.Join(renamed, "a.txt")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, w); e != (Event{Op: Create, Path: file}) {
+		t.Errorf("create in renamed directory: got %+v", e)
+	}
+
+	// Moving out of the watched directories is a removal
+	outside := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.Rename(file, outside); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, w); e != (Event{Op: Remove, Path: file}) {
+		t.Errorf("move out: got %+v", e)
+	}
+
+	if err := os.Remove(renamed); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, w); e != (Event{Op: Remove, Path: renamed, Dir: true}) {
+		t.Errorf("rmdir: got %+v", e)
+	}
+}
+
+func TestWatcherClose(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	select {
+	case _, ok := <-w.Events():
+		if ok {
+			t.Error("expected no events after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events was not closed")
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
@@ -67,8 +67,11 @@ remove_bash_integration() {
         # Create backup
         cp "$rc_file" "$rc_file.bcd_backup"
 
-        # Remove the integration block (from marker to end of function)
-        sed -i.tmp '/# bcd shell integration/,/^}$/d' "$rc_file"
+        # Remove the marker and the `bcd-bin init` line after it, or, for
+        # older installs, the whole function block up to its closing brace
+        sed -i.tmp \
+            -e '/^# bcd shell integration$/{N;/\n.*bcd-bin init/d;}' \
+            -e '/# bcd shell integration/,/^}$/d' "$rc_file"
         rm -f "$rc_file.tmp"
 
         info "Bash integration removed (backup saved as $rc_file.bcd_backup)"
@@ -91,8 +94,11 @@ remove_zsh_integration() {
         # Create backup
         cp "$rc_file" "$rc_file.bcd_backup"
 
-        # Remove the integration block (from marker to end of function)
-        sed -i.tmp '/# bcd shell integration/,/^}$/d' "$rc_file"
+        # Remove the marker and the `bcd-bin init` line after it, or, for
+        # older installs, the whole function block up to its closing brace
+        sed -i.tmp \
+            -e '/^# bcd shell integration$/{N;/\n.*bcd-bin init/d;}' \
+            -e '/# bcd shell integration/,/^}$/d' "$rc_file"
         rm -f "$rc_file.tmp"
 
         info "Zsh integration removed (backup saved as $rc_file.bcd_backup)"
@@ -102,8 +108,25 @@ remove_zsh_integration() {
 
 # Remove fish integration
 remove_fish_integration() {
+    local config_file="$HOME/.config/fish/config.fish"
     local func_file="$HOME/.config/fish/functions/bcd.fish"
+    local integration_marker="# bcd shell integration"
+
+    if [[ -f "$config_file" ]] && grep -q "$integration_marker" "$config_file" 2>/dev/null; then
+        info "Removing Fish integration from $config_file"
+
+        # Create backup
+        cp "$config_file" "$config_file.bcd_backup"
+
+        # Remove the marker and the `bcd-bin init` line after it
+        sed -i.tmp -e '/^# bcd shell integration$/{N;/\n.*bcd-bin init/d;}' "$config_file"
+        rm -f "$config_file.tmp"
+
+        info "Fish integration removed (backup saved as $config_file.bcd_backup)"
+        echo "  Changes will take effect in new fish sessions"
+    fi
 
+    # Older installs copied the function into the autoload directory
     if [[ -f "$func_file" ]]; then
         info "Removing Fish integration from $func_file"
 